@@ -0,0 +1,364 @@
+package game
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// The binary subprotocol encodes a message as its kind (by position in the
+// registry, from 1), request ID and event sequence (0 if none), followed by the fields of its type in
+// declaration order:
+//
+//   - bools are a single byte, and integers are (zig-zag) varints
+//   - strings and byte slices are a uvarint length and the bytes
+//   - cards are a single byte holding the global rank
+//   - players tagged `bin:"seat"` are a single byte holding their position
+//   - times are a varint of milliseconds since the Unix epoch
+//   - pointers, slices and maps start with a byte/uvarint telling nil apart from
+//     empty, and map entries are sorted by key
+
+var (
+	cardType   = reflect.TypeOf(card{})
+	playerType = reflect.TypeOf(player{})
+	timeType   = reflect.TypeOf(time.Time{})
+)
+
+var errShortMessage = errors.New("binary message is too short")
+
+// encodes a message of one of the kinds, along with its request ID and event
+// sequence
+func encodeBinary(kinds []messageKind, id string, seq int, message interface{}) ([]byte, error) {
+	messageType := reflect.TypeOf(message)
+	for i, kind := range kinds {
+		if kind.Type == messageType {
+			e := binaryEncoder{}
+			e.uvarint(uint64(i + 1))
+			e.bytes([]byte(id))
+			e.uvarint(uint64(seq))
+			err := e.value(reflect.ValueOf(message), false)
+			return e.buf, err
+		}
+	}
+	return nil, fmt.Errorf("unrecognised message type (%s)", messageType.Name())
+}
+
+// decodes a message of one of the kinds, returning it along with its request ID
+// and event sequence
+func decodeBinary(kinds []messageKind, data []byte) (interface{}, string, int, error) {
+	d := binaryDecoder{buf: data}
+	code, err := d.uvarint()
+	if err != nil {
+		return nil, "", 0, err
+	}
+	if code < 1 || code > uint64(len(kinds)) {
+		return nil, "", 0, fmt.Errorf("unrecognised message code (%d)", code)
+	}
+	id, err := d.bytes()
+	if err != nil {
+		return nil, "", 0, err
+	}
+	seq, err := d.uvarint()
+	if err != nil {
+		return nil, "", 0, err
+	}
+
+	message := reflect.New(kinds[code-1].Type).Elem()
+	if err := d.value(message, false); err != nil {
+		return nil, "", 0, err
+	}
+	if len(d.buf) > 0 {
+		return nil, "", 0, fmt.Errorf("binary message has %d unexpected trailing bytes", len(d.buf))
+	}
+	return message.Interface(), string(id), int(seq), nil
+}
+
+// returns the fields of a struct type that are part of its encoded form, i.e.
+// those that are marshalled to JSON
+func encodedFields(t reflect.Type) []int {
+	fields := []int{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" || field.Tag.Get("json") == "-" {
+			continue
+		}
+		fields = append(fields, i)
+	}
+	return fields
+}
+
+type binaryEncoder struct {
+	buf []byte
+}
+
+func (e *binaryEncoder) uvarint(v uint64) {
+	e.buf = append(e.buf, make([]byte, binary.MaxVarintLen64)...)
+	n := binary.PutUvarint(e.buf[len(e.buf)-binary.MaxVarintLen64:], v)
+	e.buf = e.buf[:len(e.buf)-binary.MaxVarintLen64+n]
+}
+
+func (e *binaryEncoder) varint(v int64) {
+	e.buf = append(e.buf, make([]byte, binary.MaxVarintLen64)...)
+	n := binary.PutVarint(e.buf[len(e.buf)-binary.MaxVarintLen64:], v)
+	e.buf = e.buf[:len(e.buf)-binary.MaxVarintLen64+n]
+}
+
+func (e *binaryEncoder) bytes(b []byte) {
+	e.uvarint(uint64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+// encodes a value, where seat is true if players are encoded as their position
+func (e *binaryEncoder) value(v reflect.Value, seat bool) error {
+	switch v.Type() {
+	case cardType:
+		e.buf = append(e.buf, byte(v.Interface().(card).GlobalRank))
+		return nil
+	case timeType:
+		// not UnixNano, which overflows for the zero time
+		t := v.Interface().(time.Time)
+		e.varint(t.Unix()*1000 + int64(t.Nanosecond())/int64(time.Millisecond))
+		return nil
+	case playerType:
+		if seat {
+			e.buf = append(e.buf, byte(v.Interface().(player).Position))
+			return nil
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			e.buf = append(e.buf, 1)
+		} else {
+			e.buf = append(e.buf, 0)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.varint(v.Int())
+	case reflect.String:
+		e.bytes([]byte(v.String()))
+	case reflect.Ptr:
+		if v.IsNil() {
+			e.buf = append(e.buf, 0)
+			return nil
+		}
+		e.buf = append(e.buf, 1)
+		return e.value(v.Elem(), seat)
+	case reflect.Slice:
+		if v.IsNil() {
+			e.uvarint(0)
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			e.uvarint(uint64(v.Len()) + 1)
+			e.buf = append(e.buf, v.Bytes()...)
+			return nil
+		}
+		e.uvarint(uint64(v.Len()) + 1)
+		for i := 0; i < v.Len(); i++ {
+			if err := e.value(v.Index(i), seat); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("cannot encode map with %s keys", v.Type().Key())
+		}
+		if v.IsNil() {
+			e.uvarint(0)
+			return nil
+		}
+		keys := []string{}
+		for _, key := range v.MapKeys() {
+			keys = append(keys, key.String())
+		}
+		sort.Strings(keys)
+		e.uvarint(uint64(len(keys)) + 1)
+		for _, key := range keys {
+			e.bytes([]byte(key))
+			if err := e.value(v.MapIndex(reflect.ValueOf(key).Convert(v.Type().Key())), seat); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		for _, i := range encodedFields(v.Type()) {
+			fieldSeat := v.Type().Field(i).Tag.Get("bin") == "seat"
+			if err := e.value(v.Field(i), fieldSeat); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("cannot encode %s", v.Type())
+	}
+	return nil
+}
+
+type binaryDecoder struct {
+	buf []byte
+}
+
+func (d *binaryDecoder) byte() (byte, error) {
+	if len(d.buf) == 0 {
+		return 0, errShortMessage
+	}
+	b := d.buf[0]
+	d.buf = d.buf[1:]
+	return b, nil
+}
+
+func (d *binaryDecoder) uvarint() (uint64, error) {
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		return 0, errShortMessage
+	}
+	d.buf = d.buf[n:]
+	return v, nil
+}
+
+func (d *binaryDecoder) varint() (int64, error) {
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		return 0, errShortMessage
+	}
+	d.buf = d.buf[n:]
+	return v, nil
+}
+
+func (d *binaryDecoder) take(n uint64) ([]byte, error) {
+	if uint64(len(d.buf)) < n {
+		return nil, errShortMessage
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b, nil
+}
+
+func (d *binaryDecoder) bytes() ([]byte, error) {
+	n, err := d.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	return d.take(n)
+}
+
+// decodes into a settable value, where seat is true if players are encoded as
+// their position
+func (d *binaryDecoder) value(v reflect.Value, seat bool) error {
+	switch v.Type() {
+	case cardType:
+		b, err := d.byte()
+		if err != nil {
+			return err
+		}
+		for _, c := range buildDeck() {
+			if c.GlobalRank == int(b) {
+				v.Set(reflect.ValueOf(c))
+				return nil
+			}
+		}
+		return fmt.Errorf("unrecognised card (%d)", b)
+	case timeType:
+		ms, err := d.varint()
+		if err != nil {
+			return err
+		}
+		seconds, millis := ms/1000, ms%1000
+		if millis < 0 {
+			seconds--
+			millis += 1000
+		}
+		v.Set(reflect.ValueOf(time.Unix(seconds, millis*int64(time.Millisecond)).UTC()))
+		return nil
+	case playerType:
+		if seat {
+			b, err := d.byte()
+			if err != nil {
+				return err
+			}
+			v.Set(reflect.ValueOf(player{Position: int(b)}))
+			return nil
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		b, err := d.byte()
+		if err != nil {
+			return err
+		}
+		v.SetBool(b != 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := d.varint()
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.String:
+		b, err := d.bytes()
+		if err != nil {
+			return err
+		}
+		v.SetString(string(b))
+	case reflect.Ptr:
+		b, err := d.byte()
+		if err != nil || b == 0 {
+			return err
+		}
+		v.Set(reflect.New(v.Type().Elem()))
+		return d.value(v.Elem(), seat)
+	case reflect.Slice:
+		n, err := d.uvarint()
+		if err != nil || n == 0 {
+			return err
+		}
+		n--
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b, err := d.take(n)
+			if err != nil {
+				return err
+			}
+			v.SetBytes(append([]byte{}, b...))
+			return nil
+		}
+		if n > uint64(len(d.buf)) {
+			// every element takes at least a byte
+			return errShortMessage
+		}
+		v.Set(reflect.MakeSlice(v.Type(), int(n), int(n)))
+		for i := 0; i < int(n); i++ {
+			if err := d.value(v.Index(i), seat); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		n, err := d.uvarint()
+		if err != nil || n == 0 {
+			return err
+		}
+		v.Set(reflect.MakeMap(v.Type()))
+		for i := uint64(1); i < n; i++ {
+			key, err := d.bytes()
+			if err != nil {
+				return err
+			}
+			value := reflect.New(v.Type().Elem()).Elem()
+			if err := d.value(value, seat); err != nil {
+				return err
+			}
+			v.SetMapIndex(reflect.ValueOf(string(key)).Convert(v.Type().Key()), value)
+		}
+	case reflect.Struct:
+		for _, i := range encodedFields(v.Type()) {
+			fieldSeat := v.Type().Field(i).Tag.Get("bin") == "seat"
+			if err := d.value(v.Field(i), fieldSeat); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("cannot decode %s", v.Type())
+	}
+	return nil
+}
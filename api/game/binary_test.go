@@ -0,0 +1,112 @@
+package game
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fills a value with made-up content, where seat is true if only the position
+// of a player survives encoding
+func fillSample(v reflect.Value, seat bool) {
+	switch v.Type() {
+	case cardType:
+		v.Set(reflect.ValueOf(buildDeck()[7]))
+		return
+	case timeType:
+		v.Set(reflect.ValueOf(time.Date(2020, 1, 2, 3, 4, 5, 6e6, time.UTC)))
+		return
+	case playerType:
+		if seat {
+			v.Set(reflect.ValueOf(player{Position: 3}))
+			return
+		}
+	case reflect.TypeOf(json.RawMessage{}):
+		v.SetBytes([]byte(`{"a":1}`))
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(-300)
+	case reflect.String:
+		v.SetString("Al")
+	case reflect.Ptr:
+		v.Set(reflect.New(v.Type().Elem()))
+		fillSample(v.Elem(), seat)
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 2, 2))
+		for i := 0; i < 2; i++ {
+			fillSample(v.Index(i), seat)
+		}
+	case reflect.Map:
+		v.Set(reflect.MakeMap(v.Type()))
+		value := reflect.New(v.Type().Elem()).Elem()
+		fillSample(value, seat)
+		v.SetMapIndex(reflect.ValueOf("Al"), value)
+	case reflect.Struct:
+		for _, i := range encodedFields(v.Type()) {
+			fillSample(v.Field(i), v.Type().Field(i).Tag.Get("bin") == "seat")
+		}
+	}
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	for _, kinds := range [][]messageKind{requestKinds(), responseKinds()} {
+		for _, kind := range kinds {
+			for _, filled := range []bool{false, true} {
+				message := reflect.New(kind.Type).Elem()
+				if filled {
+					fillSample(message, false)
+				}
+
+				encoded, err := encodeBinary(kinds, "req-1", 42, message.Interface())
+				assert.Nil(t, err, kind.Ident)
+				decoded, id, seq, err := decodeBinary(kinds, encoded)
+				assert.Nil(t, err, kind.Ident)
+				assert.Equal(t, "req-1", id)
+				assert.Equal(t, 42, seq)
+
+				// the binary form must carry the same content as the JSON form
+				expected, _ := json.Marshal(message.Interface())
+				actual, _ := json.Marshal(decoded)
+				assert.JSONEq(t, string(expected), string(actual), kind.Ident)
+			}
+		}
+	}
+}
+
+func TestBinaryIsCompact(t *testing.T) {
+	response := turnPlayedResponse{
+		Player: player{Name: "Al", Position: 2, CardsLeft: 10},
+		Cards:  buildDeck()[:3],
+	}
+	encoded, err := encodeBinary(responseKinds(), "", 0, response)
+	assert.Nil(t, err)
+
+	// kind, empty ID, no sequence, seat and 3 cards
+	assert.Equal(t, 8, len(encoded))
+	decoded, _, _, err := decodeBinary(responseKinds(), encoded)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, decoded.(turnPlayedResponse).Player.Position)
+	assert.Equal(t, response.Cards, decoded.(turnPlayedResponse).Cards)
+}
+
+func TestBinaryRejectsBadMessages(t *testing.T) {
+	_, _, _, err := decodeBinary(requestKinds(), []byte{})
+	assert.NotNil(t, err)
+	_, _, _, err = decodeBinary(requestKinds(), []byte{99, 0, 0})
+	assert.NotNil(t, err)
+
+	// TURN_PLAY claiming more cards than there are bytes
+	encoded, _ := encodeBinary(requestKinds(), "", 0, turnPlayRequest{Cards: []int{52}})
+	_, _, _, err = decodeBinary(requestKinds(), encoded[:len(encoded)-1])
+	assert.NotNil(t, err)
+	_, _, _, err = decodeBinary(requestKinds(), append(encoded, 0))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,187 @@
+package game
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+type botLevel int
+
+const (
+	botLevelEasy      botLevel = 1              // plays the weakest card(s) it can, never passes by choice
+	botLevelMedium    botLevel = 2              // holds on to 2's and chops until they are needed
+	botLevelHard      botLevel = 3              // searches with Monte Carlo playouts of sampled deals
+	takeoverBotLevel           = botLevelMedium // plays for disconnected players
+	dangerCardsLeft            = 2
+	maxInlineBotMoves          = 1000
+)
+
+// the table as seen by a bot seat
+type botView struct {
+	Hand        []card
+	LastPlayed  []card
+	NewRound    bool
+	MustInclude *card
+	Unseen      []card        // cards held by opponents, i.e. not in hand and not yet played
+	Seats       []botSeat     // every seat in turn order, starting with the bot
+	LastBy      int           // index into Seats of who played the last cards, -1 if no-one
+	ThinkTime   time.Duration // no limit if zero, in which case only Playouts applies
+	Playouts    int
+}
+
+// a seat at the table as seen by a bot
+type botSeat struct {
+	CardsLeft int
+	IsPassed  bool
+	Placed    bool // ... which a seat that played four 2's is, despite holding cards
+}
+
+// returns the cards the bot wants to play, or nil to pass
+func chooseBotPlay(level botLevel, view botView, r *rand.Rand) []card {
+	plays := legalPlays(view.Hand, view.LastPlayed, view.NewRound, view.MustInclude)
+	if len(plays) == 0 {
+		return nil
+	}
+
+	switch level {
+	case botLevelHard:
+		return monteCarloPlay(view, plays, r)
+	case botLevelMedium:
+		return heuristicPlay(view.Hand, view.LastPlayed, view.NewRound, plays, opponentInDanger(view.Seats))
+	default:
+		return suggestPlays(plays, 1)[0]
+	}
+}
+
+// converts a name ("easy", "medium" or "hard") to a bot level
+func parseBotLevel(name string) (botLevel, error) {
+	switch name {
+	case "easy":
+		return botLevelEasy, nil
+	case "medium":
+		return botLevelMedium, nil
+	case "hard":
+		return botLevelHard, nil
+	default:
+		return 0, fmt.Errorf("unrecognised bot level (%s)", name)
+	}
+}
+
+// returns true if a play should be saved for later, i.e. contains a 2 or is a chop
+func isPrecious(play []card) bool {
+	for _, c := range play {
+		if c.FaceValue == 2 {
+			return true
+		}
+	}
+	if len(play) != 4 && len(play) < 6 {
+		return false
+	}
+	p := determinePattern(play)
+	return p == patternQuad || (p == patternSeqDoubles && len(play) >= 6)
+}
+
+// returns the number of face values a play takes only some of the hand's cards from,
+// which is a measure of how many pairs, triples and quads it breaks up
+func breakage(play, hand []card) int {
+	groups := groupBySuitRank(hand)
+	used := map[int]int{}
+	for _, c := range play {
+		used[c.SuitRank]++
+	}
+	broken := 0
+	for rank, count := range used {
+		if count < len(groups[rank]) {
+			broken++
+		}
+	}
+	return broken
+}
+
+// returns true if any opponent is close to going out
+func opponentInDanger(seats []botSeat) bool {
+	for _, seat := range seats[1:] {
+		if seat.CardsLeft > 0 && seat.CardsLeft <= dangerCardsLeft {
+			return true
+		}
+	}
+	return false
+}
+
+// picks a play that sheds cards cheaply without giving away 2's or chops, unless
+// they are needed to stop an opponent going out or to chop a 2. Returns nil to pass.
+func heuristicPlay(hand, lastPlayed []card, newRound bool, plays [][]card, danger bool) []card {
+	for _, play := range plays {
+		if len(play) == len(hand) {
+			return play
+		}
+	}
+
+	choppable := !newRound && isPrecious(lastPlayed)
+	candidates := [][]card{}
+	for _, play := range plays {
+		if !isPrecious(play) || danger || choppable {
+			candidates = append(candidates, play)
+		}
+	}
+	if len(candidates) == 0 {
+		if newRound {
+			return suggestPlays(plays, 1)[0]
+		}
+		return nil
+	}
+
+	var best []card
+	bestScore := 0
+	for _, play := range candidates {
+		// weaker top cards and fewer broken combinations are better, and when
+		// leading a round, so is shedding more cards
+		score := topRank(play) - 20*breakage(play, hand)
+		if newRound {
+			score += 10 * len(play)
+		}
+		if isPrecious(play) {
+			score -= 100
+		}
+		if best == nil || score > bestScore {
+			best = play
+			bestScore = score
+		}
+	}
+	return globalRankSort(best)
+}
+
+// runs random playouts for each candidate move (playing or passing) until the
+// bot's think time or playouts are used up, and returns the move with the best
+// average place
+func monteCarloPlay(view botView, plays [][]card, r *rand.Rand) []card {
+	candidates := append([][]card(nil), plays...)
+	if !view.NewRound {
+		candidates = append(candidates, nil)
+	}
+	if len(candidates) == 1 {
+		return candidates[0]
+	}
+
+	totals := make([]int, len(candidates))
+	counts := make([]int, len(candidates))
+	deadline := time.Now().Add(view.ThinkTime)
+	for i := 0; i < view.Playouts && (view.ThinkTime == 0 || time.Now().Before(deadline)); i++ {
+		c := i % len(candidates)
+		state := sampleDeal(view, r)
+		state.apply(candidates[c])
+		state.playout(r)
+		// a lower place is better, so score by how many seats finished behind us
+		totals[c] += len(state.Seats) - state.Seats[0].Place
+		counts[c]++
+	}
+
+	best := 0
+	for c := range candidates {
+		if counts[c] > 0 && totals[c]*counts[best] > totals[best]*counts[c] {
+			best = c
+		}
+	}
+	return candidates[best]
+}
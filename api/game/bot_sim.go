@@ -0,0 +1,165 @@
+package game
+
+import "math/rand"
+
+const (
+	maxPlayoutMoves   = 500
+	playoutRandomness = 0.1
+)
+
+// a lightweight copy of a game's table, used by bots to play out sampled deals
+type simState struct {
+	Seats      []simSeat // in turn order
+	Turn       int
+	LastPlayed []card
+	LastBy     int
+	NewRound   bool
+	placed     int
+}
+
+// a seat in a simulated game
+type simSeat struct {
+	Hand     []card
+	IsPassed bool
+	Place    int // 1 = first, 0 until the seat has played all their cards or four 2's
+}
+
+// builds a simulated game from the bot's view, dealing the unseen cards randomly
+// to the opponents according to how many cards they have left
+func sampleDeal(view botView, r *rand.Rand) *simState {
+	unseen := append([]card(nil), view.Unseen...)
+	r.Shuffle(len(unseen), func(i, j int) {
+		unseen[i], unseen[j] = unseen[j], unseen[i]
+	})
+
+	state := &simState{
+		Seats:      make([]simSeat, len(view.Seats)),
+		LastPlayed: view.LastPlayed,
+		LastBy:     view.LastBy,
+		NewRound:   view.NewRound,
+	}
+	state.Seats[0].Hand = append([]card(nil), view.Hand...)
+	dealt := 0
+	for i := 1; i < len(view.Seats); i++ {
+		n := view.Seats[i].CardsLeft
+		if dealt+n > len(unseen) {
+			n = len(unseen) - dealt
+		}
+		state.Seats[i].Hand = unseen[dealt : dealt+n : dealt+n]
+		state.Seats[i].IsPassed = view.Seats[i].IsPassed
+		dealt += n
+	}
+
+	// seats that have already gone out keep the best places
+	for i := range state.Seats {
+		if len(state.Seats[i].Hand) == 0 || view.Seats[i].Placed {
+			state.placed++
+			state.Seats[i].Place = state.placed
+		}
+	}
+	return state
+}
+
+// returns true once at most one seat is still to be placed
+func (s *simState) finished() bool {
+	return s.unplacedCount() <= 1
+}
+
+// returns the number of seats still to be placed
+func (s *simState) unplacedCount() int {
+	count := 0
+	for _, seat := range s.Seats {
+		if seat.Place == 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// plays the cards for the seat whose turn it is, or passes if play is nil
+func (s *simState) apply(play []card) {
+	seat := &s.Seats[s.Turn]
+	if play == nil {
+		seat.IsPassed = true
+	} else {
+		hand := []card{}
+		for _, c := range seat.Hand {
+			if cardInSet(c.GlobalRank, play) == -1 {
+				hand = append(hand, c)
+			}
+		}
+		seat.Hand = hand
+		s.LastPlayed = play
+		s.LastBy = s.Turn
+		s.NewRound = false
+		// as in the game, four 2's place the seat but it keeps its other cards
+		fourTwos := determinePattern(play) == patternQuad && play[0].FaceValue == 2
+		if seat.Place == 0 && (len(hand) == 0 || fourTwos) {
+			s.placed++
+			seat.Place = s.placed
+		}
+	}
+	s.advance()
+}
+
+// moves the turn on, starting a new round if no-one is left to respond
+func (s *simState) advance() {
+	if s.finished() {
+		for i := range s.Seats {
+			if s.Seats[i].Place == 0 {
+				s.placed++
+				s.Seats[i].Place = s.placed
+			}
+		}
+		return
+	}
+
+	for i := 1; i <= len(s.Seats); i++ {
+		next := (s.Turn + i) % len(s.Seats)
+		seat := s.Seats[next]
+		if next != s.LastBy && !seat.IsPassed && len(seat.Hand) > 0 {
+			s.Turn = next
+			return
+		}
+	}
+
+	// everyone else has passed, so the last player (or whoever is next, if
+	// they have gone out) leads a new round
+	for i := range s.Seats {
+		s.Seats[i].IsPassed = false
+	}
+	s.LastPlayed = nil
+	s.NewRound = true
+	if s.LastBy < 0 {
+		s.LastBy = s.Turn
+	}
+	for i := 0; i < len(s.Seats); i++ {
+		next := (s.LastBy + i) % len(s.Seats)
+		if len(s.Seats[next].Hand) > 0 {
+			s.Turn = next
+			return
+		}
+	}
+}
+
+// plays the game out to the end using the heuristic bot for every seat, with a
+// little randomness so that playouts of the same deal differ
+func (s *simState) playout(r *rand.Rand) {
+	for moves := 0; !s.finished() && moves < maxPlayoutMoves; moves++ {
+		hand := s.Seats[s.Turn].Hand
+		plays := legalPlays(hand, s.LastPlayed, s.NewRound, nil)
+		if len(plays) == 0 {
+			s.apply(nil)
+			continue
+		}
+		if r.Float64() < playoutRandomness {
+			s.apply(plays[r.Intn(len(plays))])
+			continue
+		}
+		danger := false
+		for i, seat := range s.Seats {
+			danger = danger || (i != s.Turn && len(seat.Hand) > 0 && len(seat.Hand) <= dangerCardsLeft)
+		}
+		s.apply(heuristicPlay(hand, s.LastPlayed, s.NewRound, plays, danger))
+	}
+}
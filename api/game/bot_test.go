@@ -0,0 +1,135 @@
+package game
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEasyBotPlaysWeakest(t *testing.T) {
+	hand := []card{
+		{Suit: suitClubs, FaceValue: 4, SuitRank: 12, GlobalRank: 47},
+		{Suit: suitHearts, FaceValue: 9, SuitRank: 7, GlobalRank: 25},
+		{Suit: suitHearts, FaceValue: 2, SuitRank: 1, GlobalRank: 1},
+	}
+	view := botView{
+		Hand:       hand,
+		LastPlayed: []card{{Suit: suitSpades, FaceValue: 6, SuitRank: 10, GlobalRank: 40}},
+		Seats:      []botSeat{{CardsLeft: 3}, {CardsLeft: 5}},
+		LastBy:     1,
+	}
+	assert.Equal(t, []card{hand[1]}, chooseBotPlay(botLevelEasy, view, rand.New(rand.NewSource(1))))
+}
+
+func TestMediumBotConservesTwos(t *testing.T) {
+	hand := []card{
+		{Suit: suitClubs, FaceValue: 4, SuitRank: 12, GlobalRank: 47},
+		{Suit: suitHearts, FaceValue: 2, SuitRank: 1, GlobalRank: 1},
+	}
+	view := botView{
+		Hand:       hand,
+		LastPlayed: []card{{Suit: suitSpades, FaceValue: 1, SuitRank: 2, GlobalRank: 8}},
+		Seats:      []botSeat{{CardsLeft: 2}, {CardsLeft: 8}},
+		LastBy:     1,
+	}
+	r := rand.New(rand.NewSource(1))
+	assert.Nil(t, chooseBotPlay(botLevelMedium, view, r))
+
+	// ... unless an opponent is about to go out
+	view.Seats[1].CardsLeft = 1
+	assert.Equal(t, []card{hand[1]}, chooseBotPlay(botLevelMedium, view, r))
+}
+
+func TestMediumBotAvoidsBreakingPairs(t *testing.T) {
+	hand := []card{
+		{Suit: suitSpades, FaceValue: 5, SuitRank: 11, GlobalRank: 44},
+		{Suit: suitClubs, FaceValue: 5, SuitRank: 11, GlobalRank: 43},
+		{Suit: suitSpades, FaceValue: 7, SuitRank: 9, GlobalRank: 36},
+		{Suit: suitHearts, FaceValue: 13, SuitRank: 3, GlobalRank: 9},
+	}
+	view := botView{
+		Hand:       hand,
+		LastPlayed: []card{{Suit: suitSpades, FaceValue: 4, SuitRank: 12, GlobalRank: 48}},
+		Seats:      []botSeat{{CardsLeft: 4}, {CardsLeft: 8}},
+		LastBy:     1,
+	}
+	assert.Equal(t, []card{hand[2]}, chooseBotPlay(botLevelMedium, view, rand.New(rand.NewSource(1))))
+}
+
+func TestHardBotPlaysLegally(t *testing.T) {
+	deck := buildDeck()
+	hand := []card{deck[0], deck[5], deck[6], deck[20], deck[40], deck[51]}
+	unseen := []card{}
+	for _, c := range deck {
+		if cardInSet(c.GlobalRank, hand) == -1 {
+			unseen = append(unseen, c)
+		}
+	}
+	view := botView{
+		Hand:        hand,
+		NewRound:    true,
+		MustInclude: &hand[0],
+		Unseen:      unseen[:12],
+		Seats:       []botSeat{{CardsLeft: 6}, {CardsLeft: 6}, {CardsLeft: 6}},
+		LastBy:      -1,
+		ThinkTime:   50 * time.Millisecond,
+		Playouts:    200,
+	}
+	play := chooseBotPlay(botLevelHard, view, rand.New(rand.NewSource(1)))
+	assert.NotEqual(t, patternInvalid, determinePattern(play))
+	assert.NotEqual(t, -1, cardInSet(hand[0].GlobalRank, play))
+}
+
+func TestPlayoutPlacesEverySeat(t *testing.T) {
+	r := rand.New(rand.NewSource(42))
+	deck := buildDeck()
+	r.Shuffle(len(deck), func(i, j int) { deck[i], deck[j] = deck[j], deck[i] })
+	view := botView{
+		Hand:     deck[:13],
+		NewRound: true,
+		Unseen:   deck[13:],
+		Seats:    []botSeat{{CardsLeft: 13}, {CardsLeft: 13}, {CardsLeft: 13}, {CardsLeft: 13}},
+		LastBy:   -1,
+	}
+	state := sampleDeal(view, r)
+	state.playout(r)
+
+	assert.True(t, state.finished())
+	places := map[int]bool{}
+	for _, seat := range state.Seats {
+		places[seat.Place] = true
+	}
+	assert.Equal(t, map[int]bool{1: true, 2: true, 3: true, 4: true}, places)
+}
+
+func TestPlayoutPlacesFourTwosLikeTheGame(t *testing.T) {
+	g, _ := newTestTable(DefaultRules(), "Al", "Bo", "Cy")
+	withLock(g, func() {
+		g.startGame(g.players[0])
+		al, bo, cy := g.players.GetByName("Al"), g.players.GetByName("Bo"), g.players.GetByName("Cy")
+		deck := buildDeck()
+		al.Hand = append([]card{deck[0]}, deck[48:]...)
+		bo.Hand = append([]card(nil), deck[1:14]...)
+		cy.Hand = append([]card(nil), deck[14:27]...)
+		for _, player := range g.players {
+			player.CardsLeft = len(player.Hand)
+			player.IsTurn = player == al
+		}
+		g.firstRound = false
+		g.setNewRound()
+
+		// Al leads four 2's in both the game and a playout of the same table
+		state := sampleDeal(g.botViewFor(al), rand.New(rand.NewSource(1)))
+		state.apply(deck[48:])
+		assert.Nil(t, g.playTurn(al, []int{4, 3, 2, 1}))
+
+		// both place Al first with a card left, and play on to the same seat
+		assert.Equal(t, players{al}, g.winPlaces)
+		assert.Equal(t, 1, state.Seats[0].Place)
+		assert.Equal(t, al.CardsLeft, len(state.Seats[0].Hand))
+		assert.Equal(t, g.isGameOver(), state.finished())
+		assert.Equal(t, g.players.CurrentTurn(), g.players.AtPosition((al.Position-1+state.Turn)%len(g.players)+1))
+	})
+}
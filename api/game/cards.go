@@ -3,7 +3,6 @@ package game
 import (
 	"math/rand"
 	"sort"
-	"time"
 
 	"github.com/meirf/gopart"
 )
@@ -55,23 +54,28 @@ func globalRankSort(cards []card) []card {
 
 // returns true if card set A ends with a higher card than set B
 func areBetterCardsThan(setA, setB []card) bool {
-	if beatenByChop(setA, setB) {
+	return beatsWithPatterns(setA, determinePattern(setA), setB, determinePattern(setB))
+}
+
+// returns true if card set A beats set B, given the patterns of both sets
+func beatsWithPatterns(setA []card, patternA pattern, setB []card, patternB pattern) bool {
+	if choppedWithPattern(setA, patternA, setB) {
 		return true
 	}
-	samePattern := determinePattern(setA) == determinePattern(setB)
-	sameLength := len(setA) == len(setB)
-	sortedA := globalRankSort(setA)
-	sortedB := globalRankSort(setB)
-	return samePattern && sameLength && sortedA[len(sortedA)-1].GlobalRank < sortedB[len(sortedB)-1].GlobalRank
+	return patternA == patternB && len(setA) == len(setB) && topRank(setA) < topRank(setB)
 }
 
 // returns true if card set A is a chop and beats set B
 func beatenByChop(setA, setB []card) bool {
+	return choppedWithPattern(setA, determinePattern(setA), setB)
+}
+
+// returns true if card set A, with the given pattern, is a chop and beats set B
+func choppedWithPattern(setA []card, patternA pattern, setB []card) bool {
 	isSingleTwos := true
 	for _, card := range setB {
 		isSingleTwos = isSingleTwos && card.FaceValue == 2
 	}
-	patternA := determinePattern(setA)
 	isChop := patternA == patternQuad || patternA == patternSeqDoubles
 	if !isSingleTwos || !isChop {
 		return false
@@ -162,8 +166,8 @@ func determinePattern(theCards []card) pattern {
 	return patternInvalid
 }
 
-// returns a pseudo-shuffled deck of 52 cards
-func buildShuffledDeck() []card {
+// returns an ordered deck of 52 cards, lowest to highest
+func buildDeck() []card {
 	deck := make([]card, 0, 52)
 	faces := []int{3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 1, 2}
 	suits := []suit{suitSpades, suitClubs, suitDiamonds, suitHearts}
@@ -180,8 +184,12 @@ func buildShuffledDeck() []card {
 			globalRank--
 		}
 	}
+	return deck
+}
 
-	r := rand.New(rand.NewSource(time.Now().Unix()))
+// returns a pseudo-shuffled deck of 52 cards
+func buildShuffledDeck(r *rand.Rand) []card {
+	deck := buildDeck()
 	shuffled := make([]card, len(deck))
 	for i, randIndex := range r.Perm(len(deck)) {
 		shuffled[i] = deck[randIndex]
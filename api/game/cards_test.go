@@ -1,13 +1,14 @@
 package game
 
 import (
+	"math/rand"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func TestShuffleDeck(t *testing.T) {
-	deck := buildShuffledDeck()
+	deck := buildShuffledDeck(rand.New(rand.NewSource(1)))
 
 	assert.Equal(t, 52, len(deck))
 
@@ -0,0 +1,149 @@
+package game
+
+import (
+	"time"
+
+	"github.com/ishkanan/tienlen/api/utils"
+)
+
+// how long before the turn runs out that players are warned
+var turnWarnings = []time.Duration{10 * time.Second, 5 * time.Second}
+
+// tracks the time limit on the current turn
+type turnClock struct {
+	token     int     // turnToken the clock was started for
+	player    *player // ... and the player whose turn it was
+	deadline  time.Time
+	remaining time.Duration // time left on the turn while the game is paused
+	timers    []*gameTimer
+}
+
+// cancels the expiry and warning timers
+func (c *turnClock) stop() {
+	for _, t := range c.timers {
+		t.Cancel()
+	}
+	c.timers = nil
+}
+
+// brings the turn clock in line with the game: starts it afresh when the turn
+// has changed, freezes it while paused, resumes it when play continues and
+// stops it in the lobby
+func (g *Game) updateTurnClock() {
+	if !g.rules.timed() {
+		return
+	}
+
+	switch g.state {
+	case gameStateInLobby:
+		g.clock.stop()
+		g.clock = turnClock{}
+	case gameStatePaused:
+		if g.clock.timers != nil {
+			g.clock.remaining = g.clock.deadline.Sub(g.timeSource.Now())
+			g.clock.stop()
+			g.chargeTimeBank(0)
+		}
+	case gameStateRunning:
+		if g.clock.token != g.turnToken {
+			g.chargeTimeBank(g.rules.TimeIncrement)
+			thePlayer := g.players.CurrentTurn()
+			if thePlayer.PlayedByBot() {
+				// bots take their own time, and a seat taken over for running
+				// out of time would only run out again
+				g.clock.stop()
+				g.clock = turnClock{}
+			} else if g.rules.TimeBank > 0 {
+				g.startTurnClock(thePlayer, time.Duration(thePlayer.TimeBank)*time.Millisecond)
+			} else {
+				g.startTurnClock(thePlayer, g.rules.TurnTimeLimit)
+			}
+		} else if g.clock.timers == nil && g.clock.player != nil {
+			g.startTurnClock(g.clock.player, g.clock.remaining)
+		}
+	}
+}
+
+// updates the time bank of the player on the clock with the time they have
+// left, plus an increment if their turn is over
+func (g *Game) chargeTimeBank(increment time.Duration) {
+	thePlayer := g.clock.player
+	if g.rules.TimeBank == 0 || thePlayer == nil {
+		return
+	}
+	left := g.clock.remaining
+	if g.clock.timers != nil {
+		left = g.clock.deadline.Sub(g.timeSource.Now())
+	}
+	if left < 0 {
+		left = 0
+	}
+	thePlayer.TimeBank = (left + increment).Milliseconds()
+}
+
+// starts the clock for the player's turn, which runs out after d
+func (g *Game) startTurnClock(thePlayer *player, d time.Duration) {
+	g.clock.stop()
+	g.clock = turnClock{
+		token:    g.turnToken,
+		player:   thePlayer,
+		deadline: g.timeSource.Now().Add(d),
+	}
+
+	for _, before := range turnWarnings {
+		if before >= d {
+			continue
+		}
+		secondsLeft := int(before / time.Second)
+		g.clock.timers = append(g.clock.timers, g.schedule(d-before, func() {
+			g.sendToAllPlayers(turnTimerWarningResponse{Player: *thePlayer, SecondsLeft: secondsLeft})
+		}))
+	}
+	g.clock.timers = append(g.clock.timers, g.schedule(d, func() {
+		g.turnTimedOut(thePlayer)
+	}))
+}
+
+// applies the timeout action to a player who has run out of time
+func (g *Game) turnTimedOut(thePlayer *player) {
+	if g.state != gameStateRunning || !thePlayer.IsTurn {
+		return
+	}
+
+	g.clock.timers = nil
+	g.clock.remaining = 0
+	g.sendToAllPlayers(turnTimedOutResponse{Player: *thePlayer})
+	utils.LogInfo("turnTimedOut: %s has run out of time", thePlayer.Name)
+
+	switch g.rules.TimeoutAction {
+	case TimeoutBot:
+		// a bot plays for the player from now on, until they are back
+		thePlayer.BotControlled = true
+		g.sendToAllPlayers(botTakeoverResponse{Player: *thePlayer})
+		utils.LogInfo("turnTimedOut: A bot has taken over for %s", thePlayer.Name)
+		g.playBotTurn(thePlayer, chooseBotPlay(takeoverBotLevel, g.botViewFor(thePlayer), g.rng))
+		return
+	case TimeoutForfeit:
+		g.forfeit(thePlayer)
+		return
+	}
+
+	if !g.newRound {
+		if err := g.passTurn(thePlayer); err == nil {
+			return
+		}
+	}
+	lowest := globalRankSort(thePlayer.Hand)[0]
+	if err := g.playTurn(thePlayer, []int{lowest.GlobalRank}); err != nil {
+		utils.LogDebug("turnTimedOut: %s could not play their lowest card - %+v", thePlayer.Name, *err)
+	}
+}
+
+// returns when the current turn runs out, or nil if there is no time limit
+func (g Game) turnDeadline() *time.Time {
+	if g.clock.timers == nil {
+		return nil
+	}
+	deadline := g.clock.deadline
+	return &deadline
+}
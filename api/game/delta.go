@@ -0,0 +1,41 @@
+package game
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// splits a game state into its JSON fields, leaving out the version
+func stateFields(state gameStateRefreshResponse) (map[string]json.RawMessage, error) {
+	stateBytes, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(stateBytes, &fields); err != nil {
+		return nil, err
+	}
+	delete(fields, "version")
+	return fields, nil
+}
+
+// returns the delta from the previous (base version) to the current game state fields
+func diffState(previous, current map[string]json.RawMessage, baseVersion, version int) gameStateDeltaResponse {
+	delta := gameStateDeltaResponse{
+		Version:     version,
+		BaseVersion: baseVersion,
+		Changes:     map[string]json.RawMessage{},
+	}
+	for name, value := range current {
+		if string(previous[name]) != string(value) {
+			delta.Changes[name] = value
+		}
+	}
+	for name := range previous {
+		if _, ok := current[name]; !ok {
+			delta.Removed = append(delta.Removed, name)
+		}
+	}
+	sort.Strings(delta.Removed)
+	return delta
+}
@@ -0,0 +1,26 @@
+package game
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffState(t *testing.T) {
+	previous := map[string]json.RawMessage{
+		"gameState":    json.RawMessage(`2`),
+		"newRound":     json.RawMessage(`false`),
+		"turnDeadline": json.RawMessage(`"2020-01-01T00:00:00Z"`),
+	}
+	current := map[string]json.RawMessage{
+		"gameState": json.RawMessage(`3`),
+		"newRound":  json.RawMessage(`false`),
+	}
+
+	delta := diffState(previous, current, 4, 5)
+	assert.Equal(t, 4, delta.BaseVersion)
+	assert.Equal(t, 5, delta.Version)
+	assert.Equal(t, map[string]json.RawMessage{"gameState": json.RawMessage(`3`)}, delta.Changes)
+	assert.Equal(t, []string{"turnDeadline"}, delta.Removed)
+}
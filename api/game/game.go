@@ -1,8 +1,11 @@
 package game
 
 import (
+	"encoding/json"
+	"math/rand"
 	"reflect"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 
@@ -15,15 +18,29 @@ type gameState int
 const (
 	connStateNew     connState = 1
 	connStateDead    connState = 2
+	connStateWatch   connState = 3 // a new connection that only watches the game
 	gameStateInLobby gameState = 1
 	gameStateRunning gameState = 2
 	gameStatePaused  gameState = 3
 	maxNameLength              = 35
+	maxEventHistory            = 200 // events kept for players who re-join
+	latencyStep                = 100 // change in a player's latency (ms) that is worth telling everyone about
 )
 
 type context struct {
 	Player     *player
 	Connection IMessageSink
+	observer   bool                       // the connection only receives public events and state
+	deltas     bool                       // the player wants state deltas rather than full refreshes
+	lastState  map[string]json.RawMessage // the state deltas are based on, by field
+	lastSent   int                        // ... and its version
+}
+
+// the request currently being processed, so its outcome can be reported
+type pendingRequest struct {
+	connID string
+	id     string
+	failed bool
 }
 
 // Game encapsulates the core game logic and high-level comms to players
@@ -36,12 +53,39 @@ type Game struct {
 	connections map[string]context
 	mutex       *sync.Mutex
 	winPlaces   players
+	forfeits    players // players who forfeited the current game, in order
 	placedRound bool
+	rules       Rules
+	discards    []card
+	rng         *rand.Rand
+	timeSource  timeSource
+	turnToken   int // changes whenever a turn is taken, so stale bot moves can be detected
+	botPending  bool
+	graceTimers map[*player]*gameTimer // pending disconnect actions for absent players
+	stats       gameStats
+	inlineBots  bool // bots move immediately and synchronously, e.g. for simulations
+	clock       turnClock
+	countdown   *gameTimer // pending start of the game once everyone is ready
+	pausedBy    *player    // who asked for the game to be paused, if anyone
+	request     *pendingRequest
+	version     int              // increases with every state update sent to players
+	events      []sequencedEvent // the most recent events, for players who re-join
+	eventSeq    int              // ... and the sequence of the last one, which carries across games
+}
+
+// counts what happened during the current (or most recent) game
+type gameStats struct {
+	Moves  int
+	Rounds int
+	Chops  int
 }
 
-// NewGame builds a new game instance and calls Init()
-func NewGame() *Game {
-	g := &Game{}
+// NewGame builds a new game instance played with the given rules and calls Init()
+func NewGame(rules Rules) *Game {
+	g := &Game{
+		rules: rules,
+		rng:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
 	g.Init()
 	return g
 }
@@ -51,10 +95,37 @@ func (g *Game) Init() {
 	g.players = make(players, 0, 4)
 	g.state = gameStateInLobby
 	g.lastPlayed = nil
-	g.connections = map[string]context{}
-	g.mutex = &sync.Mutex{}
+	observers := map[string]context{}
+	for connID, context := range g.connections {
+		if context.observer {
+			observers[connID] = context
+		}
+	}
+	g.connections = observers
+	if g.mutex == nil {
+		g.mutex = &sync.Mutex{}
+	}
+	if g.rng == nil {
+		g.rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	if g.timeSource == nil {
+		g.timeSource = realTime{}
+	}
 	g.winPlaces = make(players, 0, 3)
+	g.forfeits = nil
 	g.placedRound = false
+	g.discards = nil
+	g.turnToken++
+	for _, t := range g.graceTimers {
+		t.Cancel()
+	}
+	g.graceTimers = map[*player]*gameTimer{}
+	g.clock.stop()
+	g.clock = turnClock{}
+	g.countdown.Cancel()
+	g.countdown = nil
+	g.pausedBy = nil
+	g.events = nil
 }
 
 // IsAcceptingConnections indicates if the game can accept more player connections
@@ -63,13 +134,15 @@ func (g *Game) IsAcceptingConnections() bool {
 	defer g.mutex.Unlock()
 
 	totalConnections := len(g.players) - g.disconnectedCount() + g.unmappedCount()
-	return (g.state == gameStateInLobby && totalConnections < 4) || (g.state == gameStatePaused && totalConnections < len(g.players))
+	return (g.state == gameStateInLobby && totalConnections < 4) || (g.state != gameStateInLobby && g.unmappedCount() < g.absentCount()-g.leftCount())
 }
 
 // ConnectionStateChanged informs the game of a new or expired player connection
 func (g *Game) ConnectionStateChanged(connUUID uuid.UUID, conn IMessageSink, state connState) {
 	g.mutex.Lock()
 	defer g.mutex.Unlock()
+	defer g.scheduleBotTurn()
+	defer g.updateStartCountdown()
 
 	connID := connUUID.String()
 
@@ -77,55 +150,102 @@ func (g *Game) ConnectionStateChanged(connUUID uuid.UUID, conn IMessageSink, sta
 		g.connections[connID] = context{Connection: conn}
 		return
 	}
+	if state == connStateWatch {
+		g.connections[connID] = context{Connection: conn, observer: true}
+		_ = conn.Send(g.stateFor(nil))
+		utils.LogDebug("ConnectionStateChanged: %s is watching the game", connID)
+		return
+	}
 
 	// disconnection
 
+	if g.connections[connID].observer {
+		// observers do not sit at the table, so nothing else changes
+		delete(g.connections, connID)
+		utils.LogDebug("ConnectionStateChanged: %s has stopped watching the game", connID)
+		return
+	}
+
 	player := g.connections[connID].Player
 	if player != nil {
 		player.Connected = false
+		player.LatencyMs = 0
 		g.sendToAllPlayers(playerDisconnectedResponse{Player: *player})
 		utils.LogInfo("ConnectionStateChanged: %s has disconnected", player.Name)
 		if g.state == gameStateInLobby {
-			g.winPlaces = make(players, 0, 3)
-			g.placedRound = false
-			g.players.ResetScores()
 			// no need to keep place for player if game hasn't started
-			g.players = g.players.DeleteByName(player.Name)
-			// but we re-number positions to be sequential
-			for _, p := range g.players {
-				if p.Position > player.Position {
-					p.Position--
-				}
+			g.removeFromLobby(player)
+		} else {
+			if g.pausedBy == player {
+				// the game stays paused until the player is back, so no need to
+				// wait for them to resume it too
+				g.pausedBy = nil
+			}
+			if g.rules.DisconnectAction != DisconnectWait && !player.Forfeited {
+				g.scheduleGraceExpiry(player)
+			}
+			if g.state == gameStateRunning && !player.BotControlled && !player.Forfeited {
+				// players who have forfeited, or who a bot plays for, are not
+				// waited on, so the game carries on without them
+				g.state = gameStatePaused
+				g.sendToAllPlayers(gamePausedResponse{Deadline: g.graceDeadline(player)})
+				utils.LogInfo("ConnectionStateChanged: Game is paused due to player disconnect")
 			}
-		} else if g.state == gameStateRunning {
-			g.state = gameStatePaused
-			g.sendToAllPlayers(gamePausedResponse{})
-			utils.LogInfo("ConnectionStateChanged: Game is paused due to player disconnect")
 		}
 	} else {
 		utils.LogDebug("ConnectionStateChanged: %s has disconnected", connID)
 	}
 	delete(g.connections, connID)
 
-	if len(g.players) == g.disconnectedCount()+g.unmappedCount() {
+	if g.players.HumanCount() == g.absentCount()+g.unmappedCount() {
 		g.Init()
 		utils.LogInfo("ConnectionStateChanged: All players have left, game is reset")
 	}
+	g.updateTurnClock()
 	g.sendStateToAllPlayers()
 }
 
-// ProcessRequest informs the game about a request received over a player connection
-func (g *Game) ProcessRequest(connUUID uuid.UUID, request interface{}, requestType reflect.Type) {
+// LatencyMeasured informs the game of the round-trip time to a player connection
+func (g *Game) LatencyMeasured(connUUID uuid.UUID, latency time.Duration) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	thePlayer := g.connections[connUUID.String()].Player
+	if thePlayer == nil {
+		return
+	}
+	// rounded up, so a measured latency is never 0
+	latencyMs := int64((latency + time.Millisecond - 1) / time.Millisecond)
+	change := latencyMs - thePlayer.LatencyMs
+	thePlayer.LatencyMs = latencyMs
+	if change >= latencyStep || change <= -latencyStep {
+		g.sendStateToAllPlayers()
+	}
+}
+
+// ProcessRequest informs the game about a request received over a player
+// connection. If the request has an ID, the player is told whether it succeeded.
+func (g *Game) ProcessRequest(connUUID uuid.UUID, requestID string, request interface{}, requestType reflect.Type) {
 	g.mutex.Lock()
 	defer g.mutex.Unlock()
+	defer g.scheduleBotTurn()
+	defer g.updateStartCountdown()
 
 	connID := connUUID.String()
+	g.request = &pendingRequest{connID: connID, id: requestID}
+	defer g.acknowledgeRequest()
 
 	if requestType == reflect.TypeOf(resetGameRequest{}) {
 		g.processResetGameRequest(connID)
 		return
 	}
 
+	if requestType == reflect.TypeOf(helloRequest{}) {
+		req := request.(helloRequest)
+		g.processHelloRequest(connID, req)
+		return
+	}
+
 	if requestType == reflect.TypeOf(joinGameRequest{}) {
 		req := request.(joinGameRequest)
 		g.processJoinGameRequest(connID, req)
@@ -138,6 +258,15 @@ func (g *Game) ProcessRequest(connUUID uuid.UUID, request interface{}, requestTy
 		return
 	}
 
+	if thePlayer := g.connections[connID].Player; thePlayer.BotControlled {
+		// a connected player a bot took over from (i.e. for running out of
+		// time) takes back control as soon as they do anything
+		thePlayer.BotControlled = false
+		g.updateTurnClock()
+		g.sendStateToAllPlayers()
+		utils.LogInfo("ProcessRequest: %s has taken back control from the bot", thePlayer.Name)
+	}
+
 	if requestType == reflect.TypeOf(startGameRequest{}) {
 		g.processStartGameRequest(connID)
 		return
@@ -149,6 +278,51 @@ func (g *Game) ProcessRequest(connUUID uuid.UUID, request interface{}, requestTy
 		return
 	}
 
+	if requestType == reflect.TypeOf(addBotRequest{}) {
+		req := request.(addBotRequest)
+		g.processAddBotRequest(connID, req)
+		return
+	}
+
+	if requestType == reflect.TypeOf(removeBotRequest{}) {
+		req := request.(removeBotRequest)
+		g.processRemoveBotRequest(connID, req)
+		return
+	}
+
+	if requestType == reflect.TypeOf(leaveGameRequest{}) {
+		g.processLeaveGameRequest(connID)
+		return
+	}
+
+	if requestType == reflect.TypeOf(pauseGameRequest{}) {
+		g.processPauseGameRequest(connID)
+		return
+	}
+
+	if requestType == reflect.TypeOf(resumeGameRequest{}) {
+		g.processResumeGameRequest(connID)
+		return
+	}
+
+	if requestType == reflect.TypeOf(setReadyRequest{}) {
+		req := request.(setReadyRequest)
+		g.processSetReadyRequest(connID, req)
+		return
+	}
+
+	if requestType == reflect.TypeOf(syncStateRequest{}) {
+		req := request.(syncStateRequest)
+		g.syncState(connID, req.Deltas)
+		return
+	}
+
+	if requestType == reflect.TypeOf(arrangeHandRequest{}) {
+		req := request.(arrangeHandRequest)
+		g.processArrangeHandRequest(connID, req)
+		return
+	}
+
 	if g.state != gameStateRunning {
 		g.sendOnConnection(connID, errorResponse{Kind: errKindNotAuthorised})
 		return
@@ -159,6 +333,11 @@ func (g *Game) ProcessRequest(connUUID uuid.UUID, request interface{}, requestTy
 		return
 	}
 
+	if requestType == reflect.TypeOf(hintRequest{}) {
+		g.processHintRequest(connID)
+		return
+	}
+
 	if requestType == reflect.TypeOf(turnPassRequest{}) {
 		g.processTurnPassRequest(connID)
 		return
@@ -177,7 +356,15 @@ func (g *Game) processResetGameRequest(connID string) {
 	g.state = gameStateInLobby
 	g.firstRound = true
 	g.players = g.players.DeleteDisconnected()
+	for p, t := range g.graceTimers {
+		t.Cancel()
+		delete(g.graceTimers, p)
+	}
 	g.winPlaces = make(players, 0, 3)
+	g.forfeits = nil
+	g.discards = nil
+	g.turnToken++
+	g.pausedBy = nil
 	g.setNewRound()
 	g.players.ResetAllGameStatuses()
 	for _, player := range g.players {
@@ -185,15 +372,61 @@ func (g *Game) processResetGameRequest(connID string) {
 		player.CardsLeft = 0
 	}
 
+	g.updateTurnClock()
 	g.sendStateToAllPlayers()
 	g.sendToAllPlayers(gameResetResponse{Player: *thePlayer})
 	utils.LogInfo("processResetGameRequest: %s has reset the game", thePlayer.Name)
 }
 
+func (g *Game) processHelloRequest(connID string, req helloRequest) {
+	if g.connections[connID].Player != nil {
+		// the handshake comes before joining
+		g.sendOnConnection(connID, errorResponse{Kind: errKindNotAuthorised})
+		return
+	}
+	if req.ProtocolVersion < minProtocolVersion || req.ProtocolVersion > protocolVersion {
+		g.sendOnConnection(connID, errorResponse{Kind: errKindIncompatible, Details: &errorDetails{
+			MinProtocolVersion: minProtocolVersion,
+			MaxProtocolVersion: protocolVersion,
+		}})
+		g.connections[connID].Connection.Close()
+		utils.LogInfo("processHelloRequest: %s uses unsupported protocol version %d", connID, req.ProtocolVersion)
+		return
+	}
+
+	context := g.connections[connID]
+	for _, feature := range req.Features {
+		if feature == featureStateDeltas {
+			context.deltas = true
+		}
+	}
+	g.connections[connID] = context
+
+	g.sendOnConnection(connID, helloResponse{
+		ProtocolVersion:    protocolVersion,
+		MinProtocolVersion: minProtocolVersion,
+		Rules:              g.rules.info(),
+		Features:           g.features(),
+	})
+	utils.LogDebug("processHelloRequest: %s uses protocol version %d with features %v", connID, req.ProtocolVersion, req.Features)
+}
+
+// lists the optional parts of the protocol that are enabled
+func (g Game) features() []string {
+	features := []string{featureRequestIDs, featureStateDeltas, featureEventReplay}
+	if g.rules.HintsEnabled {
+		features = append(features, featureHints)
+	}
+	if g.rules.timed() {
+		features = append(features, featureTurnClock)
+	}
+	return features
+}
+
 func (g *Game) processJoinGameRequest(connID string, req joinGameRequest) {
 	thePlayer := g.players.GetByName(req.PlayerName)
 
-	rejoined := thePlayer != nil
+	rejoined := thePlayer != nil && !thePlayer.HasLeft
 	for cID, context := range g.connections {
 		// prevent someone hijacking a connected player
 		if cID != connID && context.Player != nil {
@@ -202,7 +435,7 @@ func (g *Game) processJoinGameRequest(connID string, req joinGameRequest) {
 	}
 
 	if !rejoined {
-		if g.state == gameStatePaused {
+		if g.state != gameStateInLobby {
 			g.sendOnConnection(connID, errorResponse{Kind: errKindGameFull})
 			g.connections[connID].Connection.Close()
 			utils.LogInfo("processJoinGameRequest: %s tried to join, but game is full", connID)
@@ -235,31 +468,51 @@ func (g *Game) processJoinGameRequest(connID string, req joinGameRequest) {
 	context.Player = thePlayer
 	g.connections[connID] = context
 
+	if rejoined {
+		// the player takes back control from the bot, if it had taken over
+		g.graceTimers[thePlayer].Cancel()
+		delete(g.graceTimers, thePlayer)
+		thePlayer.BotControlled = false
+		if req.LastEventSeq != nil {
+			g.replayEvents(connID, *req.LastEventSeq)
+		}
+	}
+
 	g.sendToAllPlayers(playerJoinedResponse{Player: *thePlayer})
 	utils.LogInfo("processJoinGameRequest: %s has joined the game on %s", thePlayer.Name, connID)
 
-	if rejoined && g.disconnectedCount() == 0 {
+	if rejoined && g.canResume() {
 		g.state = gameStateRunning
 		g.sendToAllPlayers(gameResumedResponse{})
 		utils.LogInfo("processJoinGameRequest: All players have re-joined, game is resumed")
 	}
 
+	g.updateTurnClock()
 	g.sendStateToAllPlayers()
 }
 
 func (g *Game) processStartGameRequest(connID string) {
 	thePlayer := g.connections[connID].Player
 
-	if g.state != gameStateInLobby || len(g.players) < 2 || g.disconnectedCount() > 0 || g.unmappedCount() > 0 {
+	if !g.canStart() {
 		g.sendOnConnection(connID, errorResponse{Kind: errKindNotAuthorised})
 		utils.LogDebug("processStartGameRequest: Unauthorised attempt by %s", thePlayer.Name)
 		return
 	}
 
-	deck := buildShuffledDeck()
+	g.startGame(thePlayer)
+}
+
+// deals the cards and starts the game on behalf of a player
+func (g *Game) startGame(thePlayer *player) {
+	deck := buildShuffledDeck(g.rng)
 	for i, player := range g.players {
 		player.Hand = globalRankSort(deck[i*13 : (i*13)+13])
 		player.CardsLeft = 13
+		player.HintsUsed = 0
+		player.IsReady = player.IsBot
+		player.PausesUsed = 0
+		player.TimeBank = g.rules.TimeBank.Milliseconds()
 	}
 
 	first := g.players.WonLastGame()
@@ -270,23 +523,35 @@ func (g *Game) processStartGameRequest(connID string) {
 	g.state = gameStateRunning
 	g.firstRound = true
 	g.winPlaces = make(players, 0, 3)
+	g.forfeits = nil
+	g.discards = nil
+	g.turnToken++
+	g.stats = gameStats{}
+	g.pausedBy = nil
 	g.setNewRound()
 
+	g.updateTurnClock()
 	g.sendStateToAllPlayers()
 	g.sendToAllPlayers(gameStartedResponse{Player: *thePlayer})
-	utils.LogInfo("processStartGameRequest: %s has started the game, %s starts play", thePlayer.Name, first.Name)
+	utils.LogInfo("startGame: %s has started the game, %s starts play", thePlayer.Name, first.Name)
 }
 
 func (g *Game) processTurnPassRequest(connID string) {
-	thePlayer := g.connections[connID].Player
+	if err := g.passTurn(g.connections[connID].Player); err != nil {
+		g.sendOnConnection(connID, *err)
+	}
+}
 
+// passes the player's turn, or returns an error if they are not allowed to pass
+func (g *Game) passTurn(thePlayer *player) *errorResponse {
 	if g.newRound {
-		g.sendOnConnection(connID, errorResponse{Kind: errKindMustPlay})
-		utils.LogDebug("processTurnPassRequest: Unauthorised attempt by %s", thePlayer.Name)
-		return
+		utils.LogDebug("passTurn: Unauthorised attempt by %s", thePlayer.Name)
+		return &errorResponse{Kind: errKindMustPlay}
 	}
 
-	utils.LogInfo("processTurnPassRequest: %s has passed their turn", thePlayer.Name)
+	utils.LogInfo("passTurn: %s has passed their turn", thePlayer.Name)
+	g.turnToken++
+	g.stats.Moves++
 
 	thePlayer.IsPassed = true
 	thePlayer.IsTurn = false
@@ -304,57 +569,103 @@ func (g *Game) processTurnPassRequest(connID string) {
 		g.setNewRound()
 	}
 
+	g.updateTurnClock()
 	g.sendStateToAllPlayers()
 	g.sendToAllPlayers(turnPassedResponse{Player: *thePlayer})
 	if g.newRound {
-		utils.LogInfo("processTurnPassRequest: %s has won the round", nextPlayer.Name)
+		utils.LogInfo("passTurn: %s has won the round", nextPlayer.Name)
 		g.sendToAllPlayers(roundWonResponse{Player: *nextPlayer})
 	}
+	return nil
 }
 
-func (g *Game) processTurnPlayRequest(connID string, req turnPlayRequest) {
+func (g *Game) processHintRequest(connID string) {
 	thePlayer := g.connections[connID].Player
 
-	if len(req.Cards) == 0 || len(req.Cards) > len(thePlayer.Hand) {
-		g.sendOnConnection(connID, errorResponse{Kind: errKindInvalidCards})
-		utils.LogDebug("processTurnPlayRequest: Rejected proposed cards from %s - invalid cards", thePlayer.Name)
+	if !g.rules.HintsEnabled {
+		g.sendOnConnection(connID, errorResponse{Kind: errKindHintsDisabled})
+		utils.LogDebug("processHintRequest: Rejected hint for %s - hints are disabled", thePlayer.Name)
 		return
 	}
+	if sinceHint := g.timeSource.Now().Sub(thePlayer.lastHint); sinceHint < g.rules.HintCooldown {
+		retryAfter := g.rules.HintCooldown - sinceHint
+		g.sendOnConnection(connID, errorResponse{Kind: errKindHintCooldown, Details: &errorDetails{RetryAfterMs: retryAfter.Milliseconds()}})
+		utils.LogDebug("processHintRequest: Rejected hint for %s - hint requested too soon", thePlayer.Name)
+		return
+	}
+
+	plays := legalPlays(thePlayer.Hand, g.lastPlayed, g.newRound, g.mustPlayCard(thePlayer))
+	thePlayer.lastHint = g.timeSource.Now()
+	thePlayer.HintsUsed++
+
+	g.sendOnConnection(connID, hintResponse{
+		Plays: suggestPlays(plays, maxHintPlays),
+		Pass:  len(plays) == 0 && !g.newRound,
+	})
+	g.sendStateToAllPlayers()
+	utils.LogInfo("processHintRequest: %s has used a hint (%d so far)", thePlayer.Name, thePlayer.HintsUsed)
+}
+
+func (g *Game) processTurnPlayRequest(connID string, req turnPlayRequest) {
+	if err := g.playTurn(g.connections[connID].Player, req.Cards); err != nil {
+		g.sendOnConnection(connID, *err)
+	}
+}
+
+// plays the cards (by global rank) for the player's turn, or returns an error if
+// the cards cannot be played
+func (g *Game) playTurn(thePlayer *player, globalRanks []int) *errorResponse {
+	if len(globalRanks) == 0 || len(globalRanks) > len(thePlayer.Hand) {
+		utils.LogDebug("playTurn: Rejected proposed cards from %s - %s", thePlayer.Name, errorTexts[errKindInvalidCards].Message)
+		return &errorResponse{Kind: errKindInvalidCards}
+	}
 
-	cardsToPlay := make([]card, 0, len(req.Cards))
+	cardsToPlay := make([]card, 0, len(globalRanks))
 	lowestCard := globalRankSort(thePlayer.Hand)[0]
 	newHand := append([]card(nil), thePlayer.Hand...)
+	missing := []int{}
 
-	for _, globalRank := range req.Cards {
+	for _, globalRank := range globalRanks {
 		i := cardInSet(globalRank, newHand)
 		if i >= 0 {
 			cardsToPlay = append(cardsToPlay, newHand[i])
 			newHand = append(newHand[:i], newHand[i+1:]...)
+		} else {
+			missing = append(missing, globalRank)
 		}
 	}
 
 	err := errKindLobbyNotReady
-	if len(cardsToPlay) != len(req.Cards) {
+	var details *errorDetails
+	if len(cardsToPlay) != len(globalRanks) {
 		err = errKindInvalidCards
+		details = &errorDetails{Cards: missing}
 	} else if determinePattern(cardsToPlay) == patternInvalid {
 		err = errKindInvalidPattern
+		details = &errorDetails{Pattern: patternInvalid, Cards: globalRanks}
 	} else if !g.newRound && !areBetterCardsThan(cardsToPlay, g.lastPlayed) {
 		err = errKindCardsNotBetter
+		details = &errorDetails{
+			Pattern:         determinePattern(cardsToPlay),
+			RequiredPattern: determinePattern(g.lastPlayed),
+			RequiredCount:   len(g.lastPlayed),
+		}
 	} else if g.firstRound && !thePlayer.WonLastGame && cardInSet(lowestCard.GlobalRank, cardsToPlay) == -1 {
 		err = errKindMustPlayLowest
+		details = &errorDetails{MustInclude: &lowestCard}
 	}
 	if err != errKindLobbyNotReady {
-		msg := map[errorKind]string{
-			errKindInvalidCards:   "invalid cards",
-			errKindInvalidPattern: "invalid pattern",
-			errKindCardsNotBetter: "cards not better than last played",
-			errKindMustPlayLowest: "must play lowest",
-		}[err]
-		g.sendOnConnection(connID, errorResponse{Kind: err})
-		utils.LogDebug("processTurnPlayRequest: Rejected proposed cards from %s - %s", thePlayer.Name, msg)
-		return
+		utils.LogDebug("playTurn: Rejected proposed cards from %s - %s", thePlayer.Name, errorTexts[err].Message)
+		return &errorResponse{Kind: err, Details: details}
+	}
+
+	if !g.newRound && beatenByChop(cardsToPlay, g.lastPlayed) {
+		g.stats.Chops++
 	}
 
+	g.turnToken++
+	g.stats.Moves++
+	g.discards = append(g.discards, cardsToPlay...)
 	thePlayer.CardsLeft = len(newHand)
 	thePlayer.Hand = newHand
 	thePlayer.IsTurn = false
@@ -370,14 +681,8 @@ func (g *Game) processTurnPlayRequest(connID string, req turnPlayRequest) {
 		g.winPlaces = append(g.winPlaces, thePlayer)
 		g.placedRound = true
 
-		if len(g.winPlaces) == len(g.players)-1 {
-			// all possible players have secured a place
-			g.state = gameStateInLobby
-			g.players.ResetAllGameStatuses()
-			g.winPlaces[0].WonLastGame = true
-			for i, player := range g.winPlaces {
-				player.Score += len(g.players) - 1 - i
-			}
+		if g.isGameOver() {
+			g.endGame()
 		} else {
 			// there are still some players to secure a place (i.e. 3-4 player game)
 			if g.players.PassedAndPlacedCount() == len(g.players) {
@@ -394,25 +699,231 @@ func (g *Game) processTurnPlayRequest(connID string, req turnPlayRequest) {
 		g.setNewRound()
 	}
 
+	g.updateTurnClock()
 	g.sendStateToAllPlayers()
 	g.sendToAllPlayers(turnPlayedResponse{
 		Player: *thePlayer,
 		Cards:  cardsToPlay,
 	})
-	utils.LogInfo("processTurnPlayRequest: %s played %+v", thePlayer.Name, cardsToPlay)
+	utils.LogInfo("playTurn: %s played %+v", thePlayer.Name, cardsToPlay)
 
 	if placed {
 		g.sendToAllPlayers(playerPlacedResponse{Player: *thePlayer, Place: len(g.winPlaces)})
-		utils.LogInfo("processTurnPlayRequest: %s has played all their cards and got %s place", thePlayer.Name, utils.Ordinal(len(g.winPlaces)))
+		utils.LogInfo("playTurn: %s has played all their cards and got %s place", thePlayer.Name, utils.Ordinal(len(g.winPlaces)))
 	} else if g.newRound {
-		utils.LogInfo("processTurnPlayRequest: %s has won the round", thePlayer.Name)
+		utils.LogInfo("playTurn: %s has won the round", thePlayer.Name)
 		g.sendToAllPlayers(roundWonResponse{Player: *thePlayer})
 	}
 
 	if g.state == gameStateInLobby {
 		g.sendToAllPlayers(gameWonResponse{Player: *g.winPlaces[0]})
-		utils.LogInfo("processTurnPlayRequest: %s has won the game", g.winPlaces[0].Name)
+		utils.LogInfo("playTurn: %s has won the game", g.winPlaces[0].Name)
+	}
+	return nil
+}
+
+func (g *Game) processAddBotRequest(connID string, req addBotRequest) {
+	thePlayer := g.connections[connID].Player
+
+	if g.state != gameStateInLobby {
+		g.sendOnConnection(connID, errorResponse{Kind: errKindNotAuthorised})
+		utils.LogDebug("processAddBotRequest: Unauthorised attempt by %s", thePlayer.Name)
+		return
+	}
+	if req.Level < botLevelEasy || req.Level > botLevelHard {
+		g.sendOnConnection(connID, errorResponse{Kind: errKindInvalidBot})
+		utils.LogDebug("processAddBotRequest: %s asked for unknown bot level %d", thePlayer.Name, req.Level)
+		return
+	}
+	if len(g.players)+g.unmappedCount() >= 4 {
+		g.sendOnConnection(connID, errorResponse{Kind: errKindGameFull})
+		utils.LogDebug("processAddBotRequest: %s tried to add a bot, but game is full", thePlayer.Name)
+		return
+	}
+
+	bot := &player{
+		Name:      theyWhoNotBeNamed(g.players, maxNameLength),
+		Position:  g.players.NextAvailablePosition(),
+		Connected: true,
+		IsBot:     true,
+		BotLevel:  req.Level,
+		IsReady:   true,
+	}
+	g.players = append(g.players, bot)
+	g.players.ResetAllGameStatuses()
+	g.players.ResetScores()
+	g.winPlaces = make(players, 0, 3)
+	g.placedRound = false
+
+	g.sendToAllPlayers(playerJoinedResponse{Player: *bot})
+	g.sendStateToAllPlayers()
+	utils.LogInfo("processAddBotRequest: %s has added bot %s (level %d)", thePlayer.Name, bot.Name, bot.BotLevel)
+}
+
+func (g *Game) processRemoveBotRequest(connID string, req removeBotRequest) {
+	thePlayer := g.connections[connID].Player
+
+	if g.state != gameStateInLobby {
+		g.sendOnConnection(connID, errorResponse{Kind: errKindNotAuthorised})
+		utils.LogDebug("processRemoveBotRequest: Unauthorised attempt by %s", thePlayer.Name)
+		return
+	}
+	bot := g.players.GetByName(req.Name)
+	if bot == nil || !bot.IsBot {
+		g.sendOnConnection(connID, errorResponse{Kind: errKindInvalidBot})
+		utils.LogDebug("processRemoveBotRequest: %s tried to remove %s, who is not a bot", thePlayer.Name, req.Name)
+		return
+	}
+
+	g.removeFromLobby(bot)
+	g.sendToAllPlayers(botRemovedResponse{Player: *bot})
+	g.sendStateToAllPlayers()
+	utils.LogInfo("processRemoveBotRequest: %s has removed bot %s", thePlayer.Name, bot.Name)
+}
+
+func (g *Game) processLeaveGameRequest(connID string) {
+	thePlayer := g.connections[connID].Player
+
+	// the connection no longer belongs to anyone, so is done with
+	g.connections[connID].Connection.Close()
+	delete(g.connections, connID)
+	thePlayer.Connected = false
+	g.sendToAllPlayers(playerLeftResponse{Player: *thePlayer})
+	utils.LogInfo("processLeaveGameRequest: %s has left the game", thePlayer.Name)
+
+	if g.state == gameStateInLobby {
+		g.removeFromLobby(thePlayer)
+	} else {
+		thePlayer.HasLeft = true
+		g.graceTimers[thePlayer].Cancel()
+		delete(g.graceTimers, thePlayer)
+		if g.pausedBy == thePlayer {
+			g.pausedBy = nil
+		}
+
+		if g.rules.DisconnectAction == DisconnectBot {
+			thePlayer.BotControlled = true
+			g.sendToAllPlayers(botTakeoverResponse{Player: *thePlayer})
+			utils.LogInfo("processLeaveGameRequest: A bot has taken over for %s", thePlayer.Name)
+		} else if !thePlayer.Forfeited {
+			g.forfeit(thePlayer)
+		}
+
+		if g.canResume() {
+			g.state = gameStateRunning
+			g.sendToAllPlayers(gameResumedResponse{})
+			utils.LogInfo("processLeaveGameRequest: No-one else is away, game is resumed")
+		}
+	}
+
+	if g.players.HumanCount() == g.absentCount()+g.unmappedCount() {
+		g.Init()
+		utils.LogInfo("processLeaveGameRequest: All players have left, game is reset")
+	}
+	g.updateTurnClock()
+	g.sendStateToAllPlayers()
+}
+
+func (g *Game) processPauseGameRequest(connID string) {
+	thePlayer := g.connections[connID].Player
+
+	if g.state != gameStateRunning || (g.rules.PauseHostOnly && thePlayer.Position != 1) {
+		g.sendOnConnection(connID, errorResponse{Kind: errKindNotAuthorised})
+		utils.LogDebug("processPauseGameRequest: Unauthorised attempt by %s", thePlayer.Name)
+		return
+	}
+	if !g.rules.PauseHostOnly && thePlayer.PausesUsed >= g.rules.PauseLimit {
+		g.sendOnConnection(connID, errorResponse{Kind: errKindNoPausesLeft})
+		utils.LogDebug("processPauseGameRequest: %s has no pauses left", thePlayer.Name)
+		return
+	}
+
+	thePlayer.PausesUsed++
+	g.pausedBy = thePlayer
+	g.state = gameStatePaused
+
+	g.updateTurnClock()
+	g.sendStateToAllPlayers()
+	g.sendToAllPlayers(gamePausedResponse{Player: thePlayer})
+	utils.LogInfo("processPauseGameRequest: %s has paused the game", thePlayer.Name)
+}
+
+func (g *Game) processResumeGameRequest(connID string) {
+	thePlayer := g.connections[connID].Player
+
+	if g.pausedBy == nil || (g.pausedBy != thePlayer && thePlayer.Position != 1) {
+		g.sendOnConnection(connID, errorResponse{Kind: errKindNotAuthorised})
+		utils.LogDebug("processResumeGameRequest: Unauthorised attempt by %s", thePlayer.Name)
+		return
+	}
+
+	g.pausedBy = nil
+	if g.canResume() {
+		g.state = gameStateRunning
+		g.sendToAllPlayers(gameResumedResponse{Player: thePlayer})
+		utils.LogInfo("processResumeGameRequest: %s has resumed the game", thePlayer.Name)
+	} else {
+		utils.LogInfo("processResumeGameRequest: %s is back, but the game waits for disconnected players", thePlayer.Name)
+	}
+
+	g.updateTurnClock()
+	g.sendStateToAllPlayers()
+}
+
+func (g *Game) processSetReadyRequest(connID string, req setReadyRequest) {
+	thePlayer := g.connections[connID].Player
+
+	if g.state != gameStateInLobby {
+		g.sendOnConnection(connID, errorResponse{Kind: errKindNotAuthorised})
+		utils.LogDebug("processSetReadyRequest: Unauthorised attempt by %s", thePlayer.Name)
+		return
+	}
+
+	thePlayer.IsReady = req.Ready
+	g.sendStateToAllPlayers()
+	utils.LogInfo("processSetReadyRequest: %s is ready: %t", thePlayer.Name, thePlayer.IsReady)
+}
+
+func (g *Game) processArrangeHandRequest(connID string, req arrangeHandRequest) {
+	thePlayer := g.connections[connID].Player
+
+	if req.Cards != nil {
+		g.rearrangeHand(connID, thePlayer, req.Cards)
+		return
+	}
+
+	partitions := partitionHand(thePlayer.Hand, maxPartitions)
+	g.sendOnConnection(connID, handArrangementResponse{Partitions: partitions})
+	utils.LogDebug("processArrangeHandRequest: %s has %d ways to arrange their hand", thePlayer.Name, len(partitions))
+}
+
+// puts the player's hand in the given order (by global rank), which must have
+// every card in the hand exactly once
+func (g *Game) rearrangeHand(connID string, thePlayer *player, globalRanks []int) {
+	remaining := append([]card(nil), thePlayer.Hand...)
+	arranged := make([]card, 0, len(globalRanks))
+	invalid := []int{}
+	for _, globalRank := range globalRanks {
+		i := cardInSet(globalRank, remaining)
+		if i == -1 {
+			invalid = append(invalid, globalRank)
+			continue
+		}
+		arranged = append(arranged, remaining[i])
+		remaining = append(remaining[:i], remaining[i+1:]...)
+	}
+	for _, c := range remaining {
+		invalid = append(invalid, c.GlobalRank)
+	}
+	if len(invalid) > 0 {
+		g.sendOnConnection(connID, errorResponse{Kind: errKindInvalidCards, Details: &errorDetails{Cards: invalid}})
+		utils.LogDebug("rearrangeHand: Rejected arrangement from %s - %s", thePlayer.Name, errorTexts[errKindInvalidCards].Message)
+		return
 	}
+
+	thePlayer.Hand = arranged
+	g.sendStateToAllPlayers()
+	utils.LogDebug("rearrangeHand: %s has rearranged their hand", thePlayer.Name)
 }
 
 func (g *Game) processChangeNameRequest(connID string, req changeNameRequest) {
@@ -431,76 +942,550 @@ func (g *Game) processChangeNameRequest(connID string, req changeNameRequest) {
 	g.sendStateToAllPlayers()
 }
 
-// returns the number of disconnected players (who we've kept places for)
+// returns the number of disconnected players (who we've kept places for) that
+// the game is waiting on, i.e. excluding those a bot has taken over or who have
+// forfeited
 func (g Game) disconnectedCount() int {
 	count := 0
 	for _, player := range g.players {
-		found := false
-		for _, context := range g.connections {
-			found = found || (context.Player != nil && context.Player.Name == player.Name)
+		if !player.BotControlled && !player.IsBot && !player.Forfeited && !g.isConnected(player) {
+			count++
+		}
+	}
+	return count
+}
+
+// returns the number of human players who do not have a connection, including
+// those a bot has taken over
+func (g Game) absentCount() int {
+	count := 0
+	for _, player := range g.players {
+		if !player.IsBot && !g.isConnected(player) {
+			count++
 		}
-		if !found {
+	}
+	return count
+}
+
+// returns the number of players who gave up their seat mid-game
+func (g Game) leftCount() int {
+	count := 0
+	for _, player := range g.players {
+		if player.HasLeft {
 			count++
 		}
 	}
 	return count
 }
 
-// returns the number of connections that are not yet mapped to players
+// returns true if a player has a connection mapped to them
+func (g Game) isConnected(thePlayer *player) bool {
+	for _, context := range g.connections {
+		if context.Player != nil && context.Player.Name == thePlayer.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the number of connections that are not yet mapped to players,
+// excluding observers
 func (g Game) unmappedCount() int {
 	count := 0
 	for _, context := range g.connections {
-		if context.Player == nil {
+		if context.Player == nil && !context.observer {
 			count++
 		}
 	}
 	return count
 }
 
-// sends a response-type message to all players
-func (g Game) sendToAllPlayers(response interface{}) {
+// sends a response-type event to all players and observers, keeping it for
+// those who miss it
+func (g *Game) sendToAllPlayers(response interface{}) {
+	g.eventSeq++
+	event := sequencedEvent{Seq: g.eventSeq, Response: response}
+	g.events = append(g.events, event)
+	if len(g.events) > maxEventHistory {
+		g.events = g.events[len(g.events)-maxEventHistory:]
+	}
+
 	for _, context := range g.connections {
-		if context.Player != nil {
-			_ = context.Connection.Send(response)
+		if context.Player != nil || context.observer {
+			_ = context.Connection.Send(event)
+		}
+	}
+}
+
+// re-sends the events after the given sequence to a connection, in order
+func (g Game) replayEvents(connID string, lastSeq int) {
+	// the kept events run up to the last one without gaps
+	oldest := g.eventSeq - len(g.events) + 1
+	complete := lastSeq <= g.eventSeq && lastSeq+1 >= oldest
+
+	count := 0
+	for _, event := range g.events {
+		if event.Seq > lastSeq {
+			g.sendOnConnection(connID, event)
+			count++
 		}
 	}
+	g.sendOnConnection(connID, eventsReplayedResponse{Count: count, Complete: complete})
+	utils.LogInfo("replayEvents: Re-sent %d events after #%d on %s", count, lastSeq, connID)
 }
 
-// sends a response-type message to a connection (mapped or un-mapped)
+// sends a response-type message to a connection (mapped or un-mapped). Errors
+// for the request being processed are tagged with its ID.
 func (g Game) sendOnConnection(connID string, response interface{}) {
+	if err, ok := response.(errorResponse); ok && g.request != nil && g.request.connID == connID {
+		err.RequestID = g.request.id
+		g.request.failed = true
+		response = err
+	}
 	_ = g.connections[connID].Connection.Send(response)
 }
 
-// sends a customised gameStateRefreshResponse to each player
-func (g Game) sendStateToAllPlayers() {
+// acknowledges the request that was just processed if it had an ID and did
+// not fail, so long as its connection is still open
+func (g *Game) acknowledgeRequest() {
+	request := g.request
+	g.request = nil
+	if request.id == "" || request.failed {
+		return
+	}
+	if _, ok := g.connections[request.connID]; ok {
+		g.sendOnConnection(request.connID, ackResponse{RequestID: request.id})
+	}
+}
+
+// sends each player (and observer) their view of the new game state: the full
+// state, or just what has changed for connections that asked for deltas
+func (g *Game) sendStateToAllPlayers() {
+	g.version++
+	for connID, context := range g.connections {
+		if context.Player == nil && !context.observer {
+			continue
+		}
+		state := g.stateFor(context.Player)
+		if !context.deltas {
+			_ = context.Connection.Send(state)
+			continue
+		}
+
+		fields, err := stateFields(state)
+		if err != nil {
+			utils.LogDebug("sendStateToAllPlayers: Marshal error for %s - %v", connID, err)
+			continue
+		}
+		if context.lastState == nil {
+			_ = context.Connection.Send(state)
+		} else {
+			_ = context.Connection.Send(diffState(context.lastState, fields, context.lastSent, g.version))
+		}
+		context.lastState = fields
+		context.lastSent = g.version
+		g.connections[connID] = context
+	}
+}
+
+// sends a player the full game state, after which they receive deltas from it
+// if they want them
+func (g *Game) syncState(connID string, deltas bool) {
+	context := g.connections[connID]
+	state := g.stateFor(context.Player)
+	context.deltas = deltas
+	context.lastState = nil
+	if deltas {
+		fields, err := stateFields(state)
+		if err != nil {
+			utils.LogDebug("syncState: Marshal error for %s - %v", connID, err)
+			return
+		}
+		context.lastState = fields
+		context.lastSent = g.version
+	}
+	g.connections[connID] = context
+	_ = context.Connection.Send(state)
+}
+
+// builds the game state as seen by a player, or the public state if there is
+// none, where every player is an opponent
+func (g Game) stateFor(thePlayer *player) gameStateRefreshResponse {
 	winPlaces := make([]player, 0, 3)
 	for _, player := range g.winPlaces {
 		winPlaces = append(winPlaces, *player)
 	}
+	pausedBy := ""
+	if g.pausedBy != nil {
+		pausedBy = g.pausedBy.Name
+	}
+	var graceDeadlines map[string]time.Time
+	for player, t := range g.graceTimers {
+		if graceDeadlines == nil {
+			graceDeadlines = map[string]time.Time{}
+		}
+		graceDeadlines[player.Name] = t.deadline
+	}
 
-	for _, context := range g.connections {
-		opponents := make([]player, 0, 3)
-		for _, player := range g.players {
-			if player.Name != context.Player.Name {
-				opponents = append(opponents, *player)
+	opponents := make([]player, 0, 3)
+	for _, player := range g.players {
+		if thePlayer == nil || player.Name != thePlayer.Name {
+			opponents = append(opponents, *player)
+		}
+	}
+	self := player{}
+	if thePlayer != nil {
+		self = *thePlayer
+	}
+
+	return gameStateRefreshResponse{
+		Version:        g.version,
+		Opponents:      opponents,
+		Self:           self,
+		SelfHand:       self.Hand,
+		GameState:      g.state,
+		LastPlayed:     g.lastPlayed,
+		FirstRound:     g.firstRound,
+		NewRound:       g.newRound,
+		WinPlaces:      winPlaces,
+		TurnDeadline:   g.turnDeadline(),
+		GraceDeadlines: graceDeadlines,
+		PausedBy:       pausedBy,
+	}
+}
+
+// returns true if a paused game has no reason to stay paused
+func (g Game) canResume() bool {
+	return g.state == gameStatePaused && g.pausedBy == nil && g.disconnectedCount() == 0
+}
+
+// returns true if a game can be started from the lobby
+func (g Game) canStart() bool {
+	return g.state == gameStateInLobby && len(g.players) >= 2 && g.absentCount() == 0 && g.unmappedCount() == 0
+}
+
+// returns true if every player in the lobby is ready
+func (g Game) allReady() bool {
+	for _, player := range g.players {
+		if !player.IsReady {
+			return false
+		}
+	}
+	return true
+}
+
+// returns true if the lobby has enough players, all of them connected and ready
+func (g Game) readyToStart() bool {
+	return g.state == gameStateInLobby && len(g.players) >= 2 && g.absentCount() == 0 && g.allReady()
+}
+
+// starts the countdown to the game starting once everyone in the lobby is
+// ready, and stops it if that is no longer the case. Connections that have not
+// joined (e.g. someone who has just opened the page) do not stop it, though it
+// stops if they join, as they are not ready yet.
+func (g *Game) updateStartCountdown() {
+	if g.readyToStart() {
+		if g.countdown == nil {
+			g.countdown = g.schedule(g.rules.StartCountdown, func() {
+				g.countdown = nil
+				if !g.readyToStart() {
+					// the table changed without cancelling the countdown
+					return
+				}
+				// started on behalf of the table, represented by the first seat
+				g.startGame(g.players.AtPosition(1))
+			})
+			g.sendToAllPlayers(startCountdownResponse{Deadline: g.countdown.deadline})
+			utils.LogInfo("updateStartCountdown: Everyone is ready, game starts in %s", g.rules.StartCountdown)
+		}
+		return
+	}
+
+	if g.countdown != nil {
+		g.countdown.Cancel()
+		g.countdown = nil
+		if g.state == gameStateInLobby {
+			g.sendToAllPlayers(startCancelledResponse{})
+			utils.LogInfo("updateStartCountdown: Not everyone is ready, countdown is cancelled")
+		}
+	}
+}
+
+// returns the card (if any) the player must include in their next play
+func (g Game) mustPlayCard(p *player) *card {
+	if !g.firstRound || p.WonLastGame || len(p.Hand) == 0 {
+		return nil
+	}
+	lowest := globalRankSort(p.Hand)[0]
+	return &lowest
+}
+
+// removes a player from the lobby, re-numbering positions to be sequential
+func (g *Game) removeFromLobby(thePlayer *player) {
+	g.winPlaces = make(players, 0, 3)
+	g.placedRound = false
+	g.players.ResetScores()
+	g.players = g.players.DeleteByName(thePlayer.Name)
+	for _, p := range g.players {
+		if p.Position > thePlayer.Position {
+			p.Position--
+		}
+	}
+}
+
+// removes players who are no longer connected once a game is over, keeping the
+// final scores of those who remain
+func (g *Game) dropAbsentPlayers() {
+	for _, thePlayer := range g.players {
+		if thePlayer.IsBot || g.isConnected(thePlayer) {
+			continue
+		}
+		g.graceTimers[thePlayer].Cancel()
+		delete(g.graceTimers, thePlayer)
+		g.players = g.players.DeleteByName(thePlayer.Name)
+		for _, p := range g.players {
+			if p.Position > thePlayer.Position {
+				p.Position--
 			}
 		}
+		utils.LogInfo("dropAbsentPlayers: %s has left the table", thePlayer.Name)
+	}
+}
+
+// applies the disconnect action to a disconnected player's seat if they do not
+// return in time: a bot takes over, they forfeit, or the game is abandoned
+func (g *Game) scheduleGraceExpiry(thePlayer *player) {
+	g.graceTimers[thePlayer].Cancel()
+	g.graceTimers[thePlayer] = g.schedule(g.rules.DisconnectGrace, func() {
+		delete(g.graceTimers, thePlayer)
+		if g.state == gameStateInLobby || g.isConnected(thePlayer) {
+			return
+		}
+
+		switch g.rules.DisconnectAction {
+		case DisconnectBot:
+			thePlayer.BotControlled = true
+			g.sendToAllPlayers(botTakeoverResponse{Player: *thePlayer})
+			utils.LogInfo("scheduleGraceExpiry: A bot has taken over for %s", thePlayer.Name)
+		case DisconnectForfeit:
+			g.forfeit(thePlayer)
+		case DisconnectAbandon:
+			g.abandonGame(thePlayer)
+			return
+		}
+
+		if g.canResume() {
+			g.state = gameStateRunning
+			g.sendToAllPlayers(gameResumedResponse{})
+			utils.LogInfo("scheduleGraceExpiry: No-one else is away, game is resumed")
+		}
+		g.updateTurnClock()
+		g.sendStateToAllPlayers()
+	})
+}
+
+// returns when a disconnected player's grace period runs out, or nil if there
+// is none
+func (g Game) graceDeadline(thePlayer *player) *time.Time {
+	t, ok := g.graceTimers[thePlayer]
+	if !ok {
+		return nil
+	}
+	deadline := t.deadline
+	return &deadline
+}
+
+// ends the current game without a result because a player has not returned,
+// keeping the scores from earlier games
+func (g *Game) abandonGame(thePlayer *player) {
+	g.state = gameStateInLobby
+	g.players.ResetAllGameStatuses()
+	g.winPlaces = make(players, 0, 3)
+	g.forfeits = nil
+	g.placedRound = false
+	g.pausedBy = nil
+	g.dropAbsentPlayers()
+
+	g.updateTurnClock()
+	g.sendStateToAllPlayers()
+	g.sendToAllPlayers(gameAbandonedResponse{Player: *thePlayer})
+	utils.LogInfo("abandonGame: %s did not return, game is abandoned", thePlayer.Name)
+}
 
-		_ = context.Connection.Send(gameStateRefreshResponse{
-			Opponents:  opponents,
-			Self:       *context.Player,
-			SelfHand:   context.Player.Hand,
-			GameState:  g.state,
-			LastPlayed: g.lastPlayed,
-			FirstRound: g.firstRound,
-			NewRound:   g.newRound,
-			WinPlaces:  winPlaces,
+// builds the view of the table a bot seat bases its next move on
+func (g Game) botViewFor(bot *player) botView {
+	view := botView{
+		Hand:        append([]card(nil), bot.Hand...),
+		LastPlayed:  g.lastPlayed,
+		NewRound:    g.newRound,
+		MustInclude: g.mustPlayCard(bot),
+		LastBy:      -1,
+		ThinkTime:   g.rules.BotThinkTime,
+		Playouts:    g.rules.BotPlayouts,
+	}
+	for i := 0; i < len(g.players); i++ {
+		seat := g.players.AtPosition((bot.Position-1+i)%len(g.players) + 1)
+		view.Seats = append(view.Seats, botSeat{
+			CardsLeft: len(seat.Hand),
+			IsPassed:  seat.IsPassed,
+			Placed:    g.winPlaces.Contains(seat),
 		})
+		if seat.LastPlayed {
+			view.LastBy = i
+		}
+	}
+	for _, c := range buildDeck() {
+		if cardInSet(c.GlobalRank, bot.Hand) == -1 && cardInSet(c.GlobalRank, g.discards) == -1 {
+			view.Unseen = append(view.Unseen, c)
+		}
+	}
+	return view
+}
+
+// schedules the current player's move if they are a bot. The move is chosen
+// without holding the game lock, and is discarded if the game has moved on.
+func (g *Game) scheduleBotTurn() {
+	if g.inlineBots {
+		g.playInlineBotTurns()
+		return
+	}
+	if g.state != gameStateRunning || g.botPending {
+		return
+	}
+	bot := g.players.CurrentTurn()
+	if bot == nil || !bot.PlayedByBot() {
+		return
+	}
+
+	g.botPending = true
+	view := g.botViewFor(bot)
+	token := g.turnToken
+	r := rand.New(rand.NewSource(g.rng.Int63()))
+
+	level := bot.BotLevel
+	if !bot.IsBot {
+		level = takeoverBotLevel
+	}
+
+	g.timeSource.AfterFunc(g.rules.BotDelay, func() {
+		play := chooseBotPlay(level, view, r)
+
+		g.mutex.Lock()
+		defer g.mutex.Unlock()
+		defer g.scheduleBotTurn()
+
+		g.botPending = false
+		if token != g.turnToken || g.state != gameStateRunning || !bot.PlayedByBot() {
+			return
+		}
+		g.playBotTurn(bot, play)
+	})
+}
+
+// plays bot moves one after the other until it is a human player's turn or the
+// game is over
+func (g *Game) playInlineBotTurns() {
+	for moves := 0; g.state == gameStateRunning && moves < maxInlineBotMoves; moves++ {
+		bot := g.players.CurrentTurn()
+		if bot == nil || !bot.PlayedByBot() {
+			return
+		}
+		level := bot.BotLevel
+		if !bot.IsBot {
+			level = takeoverBotLevel
+		}
+		g.playBotTurn(bot, chooseBotPlay(level, g.botViewFor(bot), g.rng))
+	}
+}
+
+// makes a bot's chosen move, falling back to passing if the move is rejected
+func (g *Game) playBotTurn(bot *player, play []card) {
+	if play != nil {
+		globalRanks := make([]int, 0, len(play))
+		for _, c := range play {
+			globalRanks = append(globalRanks, c.GlobalRank)
+		}
+		if err := g.playTurn(bot, globalRanks); err == nil {
+			return
+		}
+		utils.LogDebug("playBotTurn: %s had their play %+v rejected", bot.Name, play)
+	}
+	if err := g.passTurn(bot); err != nil {
+		utils.LogDebug("playBotTurn: %s could not pass - %+v", bot.Name, *err)
+	}
+}
+
+// returns true once at most one player is left holding cards
+func (g Game) isGameOver() bool {
+	return len(g.winPlaces)+len(g.forfeits) >= len(g.players)-1
+}
+
+// places any player still holding cards who has not already placed, followed by those who forfeited (the
+// first to forfeit comes last), then scores the game and returns to the lobby
+func (g *Game) endGame() {
+	for _, player := range g.players {
+		// a player who placed with four 2's still holds their other cards
+		if len(player.Hand) > 0 && !g.winPlaces.Contains(player) {
+			g.winPlaces = append(g.winPlaces, player)
+		}
+	}
+	for i := len(g.forfeits) - 1; i >= 0; i-- {
+		g.winPlaces = append(g.winPlaces, g.forfeits[i])
+	}
+	g.winPlaces = g.winPlaces[:len(g.players)-1]
+
+	g.state = gameStateInLobby
+	g.players.ResetAllGameStatuses()
+	g.winPlaces[0].WonLastGame = true
+	for i, player := range g.winPlaces {
+		player.Score += len(g.players) - 1 - i
+	}
+	g.dropAbsentPlayers()
+}
+
+// takes a player out of the current game, placing them after everyone who is
+// still playing. If it was their turn, play moves on as though they had passed.
+func (g *Game) forfeit(thePlayer *player) {
+	g.turnToken++
+	g.discards = append(g.discards, thePlayer.Hand...)
+	thePlayer.Hand = []card{}
+	thePlayer.CardsLeft = 0
+	thePlayer.Forfeited = true
+	g.forfeits = append(g.forfeits, thePlayer)
+	utils.LogInfo("forfeit: %s has forfeited the game", thePlayer.Name)
+
+	if g.isGameOver() {
+		g.endGame()
+	} else if thePlayer.IsTurn {
+		thePlayer.IsTurn = false
+		nextPlayer := g.players.NextTurn(thePlayer)
+		if nextPlayer.LastPlayed {
+			// everyone else has passed, so the last player to play wins the round
+			g.setNewRound()
+		} else if nextPlayer == thePlayer {
+			// everyone else has passed on the cards of a placed player (or
+			// our own), so start a new round for the next player
+			g.setNewRound()
+			nextPlayer = g.players.NextTurn(thePlayer)
+		}
+		nextPlayer.IsTurn = true
+	}
+	if g.state != gameStateInLobby && len(g.players)-g.players.PassedAndPlacedCount() == 1 {
+		g.setNewRound()
+	}
+
+	g.updateTurnClock()
+	g.sendStateToAllPlayers()
+	g.sendToAllPlayers(playerForfeitedResponse{Player: *thePlayer})
+	if g.state == gameStateInLobby {
+		g.sendToAllPlayers(gameWonResponse{Player: *g.winPlaces[0]})
+		utils.LogInfo("forfeit: %s has won the game", g.winPlaces[0].Name)
 	}
 }
 
 // starts a new mid-game round
 func (g *Game) setNewRound() {
+	g.stats.Rounds++
 	g.lastPlayed = nil
 	g.newRound = true
 	g.placedRound = false
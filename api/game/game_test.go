@@ -0,0 +1,788 @@
+package game
+
+import (
+	"encoding/json"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// records the responses sent to a connection
+type testSink struct {
+	mutex     sync.Mutex
+	responses []interface{}
+	lastSeq   int // ... of the last event received
+}
+
+func (s *testSink) Send(response interface{}) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if event, ok := response.(sequencedEvent); ok {
+		s.lastSeq, response = event.Seq, event.Response
+	}
+	s.responses = append(s.responses, response)
+	return nil
+}
+
+func (s *testSink) Close() error {
+	return nil
+}
+
+// connects and joins a player to the game
+func joinTestPlayer(g *Game, name string) (uuid.UUID, *testSink) {
+	connID := uuid.New()
+	sink := &testSink{}
+	g.ConnectionStateChanged(connID, sink, connStateNew)
+	g.ProcessRequest(connID, "", joinGameRequest{PlayerName: name}, reflect.TypeOf(joinGameRequest{}))
+	return connID, sink
+}
+
+// runs fn while holding the game lock
+func withLock(g *Game, fn func()) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	fn()
+}
+
+// a timeSource whose time only moves on when advanced
+type fakeTime struct {
+	mutex  sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	source  *fakeTime
+	at      time.Time
+	fn      func()
+	stopped bool
+}
+
+func (f *fakeTime) Now() time.Time {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.now
+}
+
+func (f *fakeTime) AfterFunc(d time.Duration, fn func()) stoppable {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	t := &fakeTimer{source: f, at: f.now.Add(d), fn: fn}
+	f.timers = append(f.timers, t)
+	return t
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.source.mutex.Lock()
+	defer t.source.mutex.Unlock()
+	pending := !t.stopped
+	t.stopped = true
+	return pending
+}
+
+// moves the time on by d, running the callbacks that fall due in the order
+// they are due - must not be called while holding the game lock
+func (f *fakeTime) advance(d time.Duration) {
+	f.mutex.Lock()
+	end := f.now.Add(d)
+	f.mutex.Unlock()
+	for {
+		f.mutex.Lock()
+		var next *fakeTimer
+		for _, t := range f.timers {
+			if !t.stopped && !t.at.After(end) && (next == nil || t.at.Before(next.at)) {
+				next = t
+			}
+		}
+		if next == nil {
+			f.now = end
+			f.mutex.Unlock()
+			return
+		}
+		next.stopped = true
+		f.now = next.at
+		f.mutex.Unlock()
+		next.fn()
+	}
+}
+
+// the players at a test game, and the time the game runs on
+type testTable struct {
+	game  *Game
+	time  *fakeTime
+	names []string
+	conns map[string]uuid.UUID
+	sinks map[string]*testSink
+}
+
+// builds a game with the given rules on a fake time, and joins the players
+// with the given names in order
+func newTestTable(rules Rules, names ...string) (*Game, *testTable) {
+	g := NewGame(rules)
+	table := &testTable{
+		game:  g,
+		time:  &fakeTime{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+		conns: map[string]uuid.UUID{},
+		sinks: map[string]*testSink{},
+	}
+	g.timeSource = table.time
+	for _, name := range names {
+		table.join(name)
+	}
+	return g, table
+}
+
+// connects and joins a player to the game
+func (table *testTable) join(name string) {
+	table.names = append(table.names, name)
+	table.conns[name], table.sinks[name] = joinTestPlayer(table.game, name)
+}
+
+// sends a request from the named player
+func (table *testTable) send(name string, request interface{}) {
+	table.game.ProcessRequest(table.conns[name], "", request, reflect.TypeOf(request))
+}
+
+// starts the game on behalf of the first player
+func (table *testTable) start() {
+	table.send(table.names[0], startGameRequest{})
+}
+
+// returns the responses sent to the named player so far
+func (table *testTable) responses(name string) []interface{} {
+	sink := table.sinks[name]
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	return append([]interface{}(nil), sink.responses...)
+}
+
+// counts the responses of the same type as response sent to the named player
+func (table *testTable) count(name string, response interface{}) int {
+	count := 0
+	for _, r := range table.responses(name) {
+		if reflect.TypeOf(r) == reflect.TypeOf(response) {
+			count++
+		}
+	}
+	return count
+}
+
+func TestBotTakeover(t *testing.T) {
+	rules := DefaultRules()
+	rules.BotDelay = time.Hour
+	rules.DisconnectAction = DisconnectBot
+	rules.DisconnectGrace = time.Minute
+	g, table := newTestTable(rules, "Al", "Bo")
+
+	table.start()
+	g.ConnectionStateChanged(table.conns["Bo"], nil, connStateDead)
+	table.time.advance(time.Minute - time.Second)
+	withLock(g, func() {
+		assert.Equal(t, gameStatePaused, g.state)
+	})
+
+	table.time.advance(time.Second)
+	withLock(g, func() {
+		assert.Equal(t, gameStateRunning, g.state)
+		assert.True(t, g.players.GetByName("Bo").BotControlled)
+	})
+	assert.True(t, g.IsAcceptingConnections())
+
+	table.join("Bo")
+	withLock(g, func() {
+		assert.Equal(t, gameStateRunning, g.state)
+		assert.False(t, g.players.GetByName("Bo").BotControlled)
+	})
+	assert.False(t, g.IsAcceptingConnections())
+}
+
+func TestTurnTimeLimit(t *testing.T) {
+	rules := DefaultRules()
+	rules.TurnTimeLimit = 30 * time.Second
+	g, table := newTestTable(rules, "Al", "Bo")
+	table.start()
+
+	var first *player
+	var cards int
+	withLock(g, func() {
+		first = g.players.CurrentTurn()
+		cards = len(first.Hand)
+		assert.NotNil(t, g.turnDeadline())
+	})
+
+	// players are warned before the time runs out
+	table.time.advance(25 * time.Second)
+	assert.Equal(t, len(turnWarnings), table.count("Al", turnTimerWarningResponse{}))
+	assert.Zero(t, table.count("Al", turnTimedOutResponse{}))
+
+	// the first play of the game cannot be a pass, so the lowest card is played
+	table.time.advance(5 * time.Second)
+	assert.Equal(t, 1, table.count("Al", turnTimedOutResponse{}))
+	withLock(g, func() {
+		assert.Equal(t, cards-1, len(first.Hand))
+		assert.False(t, first.IsTurn)
+	})
+}
+
+func TestTimeBankForfeit(t *testing.T) {
+	rules := DefaultRules()
+	rules.TimeBank = 20 * time.Second
+	rules.TimeoutAction = TimeoutForfeit
+	g, table := newTestTable(rules, "Al", "Bo")
+	table.start()
+
+	var first, second *player
+	withLock(g, func() {
+		first = g.players.CurrentTurn()
+		second = g.players.NextTurn(first)
+		assert.Equal(t, int64(20000), second.TimeBank)
+	})
+
+	// the player to start never moves, so forfeits and the other player wins
+	table.time.advance(20 * time.Second)
+	withLock(g, func() {
+		assert.Equal(t, gameStateInLobby, g.state)
+		assert.Equal(t, players{second}, g.winPlaces)
+		assert.Equal(t, 1, second.Score)
+		assert.Equal(t, 0, first.Score)
+	})
+}
+
+func TestTimeoutBotTakeover(t *testing.T) {
+	rules := DefaultRules()
+	rules.BotDelay = time.Hour
+	rules.TurnTimeLimit = time.Minute
+	rules.TimeoutAction = TimeoutBot
+	g, table := newTestTable(rules, "Al", "Bo")
+	table.start()
+
+	// the bot keeps the seat once the player has run out of time
+	var first *player
+	var name string
+	withLock(g, func() {
+		first = g.players.CurrentTurn()
+		name = first.Name
+	})
+	table.time.advance(time.Minute)
+	withLock(g, func() {
+		assert.True(t, first.BotControlled)
+		assert.False(t, first.IsTurn)
+		assert.Less(t, len(first.Hand), 13)
+	})
+
+	// ... until they do something
+	table.send(name, syncStateRequest{})
+	withLock(g, func() {
+		assert.False(t, first.BotControlled)
+	})
+}
+
+func TestForfeitPlacesLast(t *testing.T) {
+	g, _ := newTestTable(DefaultRules(), "Al", "Bo", "Cy")
+	withLock(g, func() {
+		g.startGame(g.players[0])
+		first := g.players.CurrentTurn()
+		g.forfeit(first)
+		assert.Equal(t, gameStateRunning, g.state)
+		assert.False(t, first.IsTurn)
+		assert.Equal(t, g.players.NextTurn(first), g.players.CurrentTurn())
+
+		// the first to forfeit is placed last, so misses out on winPlaces
+		second := g.players.CurrentTurn()
+		third := g.players.NextTurn(second)
+		g.forfeit(third)
+		assert.Equal(t, gameStateInLobby, g.state)
+		assert.Equal(t, players{second, third}, g.winPlaces)
+		assert.Equal(t, []int{2, 1, 0}, []int{second.Score, third.Score, first.Score})
+	})
+}
+
+func TestFourTwosPlacesOnce(t *testing.T) {
+	g, _ := newTestTable(DefaultRules(), "Al", "Bo", "Cy")
+	withLock(g, func() {
+		g.startGame(g.players[0])
+		al, bo, cy := g.players.GetByName("Al"), g.players.GetByName("Bo"), g.players.GetByName("Cy")
+		g.forfeit(cy)
+
+		// Al leads a new round with four 2's, placing with a card left over
+		deck := buildDeck()
+		g.players.CurrentTurn().IsTurn = false
+		al.IsTurn = true
+		al.Hand = append([]card{deck[0]}, deck[48:]...)
+		al.CardsLeft = len(al.Hand)
+		g.firstRound = false
+		g.setNewRound()
+		assert.Nil(t, g.playTurn(al, []int{4, 3, 2, 1}))
+
+		// Al is placed once only, ahead of Bo who still holds cards
+		assert.Equal(t, gameStateInLobby, g.state)
+		assert.Equal(t, players{al, bo}, g.winPlaces)
+		assert.Equal(t, []int{2, 1, 0}, []int{al.Score, bo.Score, cy.Score})
+	})
+}
+
+func TestDisconnectForfeit(t *testing.T) {
+	rules := DefaultRules()
+	rules.DisconnectAction = DisconnectForfeit
+	rules.DisconnectGrace = time.Minute
+	g, table := newTestTable(rules, "Al", "Bo", "Cy")
+	table.start()
+	g.ConnectionStateChanged(table.conns["Bo"], nil, connStateDead)
+
+	responses := table.responses("Al")
+	paused := responses[len(responses)-2].(gamePausedResponse)
+	assert.Equal(t, table.time.Now().Add(time.Minute), *paused.Deadline)
+
+	table.time.advance(time.Minute)
+	withLock(g, func() {
+		assert.Equal(t, gameStateRunning, g.state)
+		assert.True(t, g.players.GetByName("Bo").Forfeited)
+		assert.Empty(t, g.players.GetByName("Bo").Hand)
+		assert.Equal(t, 0, g.disconnectedCount())
+	})
+}
+
+func TestDisconnectAfterForfeit(t *testing.T) {
+	rules := DefaultRules()
+	rules.TurnTimeLimit = time.Minute
+	rules.TimeoutAction = TimeoutForfeit
+	g, table := newTestTable(rules, "Al", "Bo", "Cy")
+	table.start()
+
+	var name string
+	withLock(g, func() {
+		name = g.players.CurrentTurn().Name
+	})
+	table.time.advance(time.Minute)
+
+	// the game is not held up for a player who has already forfeited
+	g.ConnectionStateChanged(table.conns[name], nil, connStateDead)
+	withLock(g, func() {
+		assert.True(t, g.players.GetByName(name).Forfeited)
+		assert.Equal(t, gameStateRunning, g.state)
+	})
+	for _, other := range table.names {
+		if other != name {
+			assert.Zero(t, table.count(other, gamePausedResponse{}))
+		}
+	}
+}
+
+func TestDisconnectAbandon(t *testing.T) {
+	rules := DefaultRules()
+	rules.DisconnectAction = DisconnectAbandon
+	rules.DisconnectGrace = time.Minute
+	g, table := newTestTable(rules, "Al", "Bo")
+	table.start()
+	g.ConnectionStateChanged(table.conns["Bo"], nil, connStateDead)
+
+	table.time.advance(time.Minute)
+	withLock(g, func() {
+		assert.Equal(t, gameStateInLobby, g.state)
+		assert.Equal(t, 1, len(g.players))
+		assert.Empty(t, g.players[0].Hand)
+	})
+}
+
+func TestReadyCountdown(t *testing.T) {
+	rules := DefaultRules()
+	rules.StartCountdown = 5 * time.Second
+	g, table := newTestTable(rules, "Al", "Bo")
+
+	table.send("Al", setReadyRequest{Ready: true})
+	withLock(g, func() {
+		assert.Nil(t, g.countdown)
+	})
+
+	// un-readying cancels the countdown
+	table.send("Bo", setReadyRequest{Ready: true})
+	withLock(g, func() {
+		assert.NotNil(t, g.countdown)
+	})
+	table.send("Al", setReadyRequest{Ready: false})
+	withLock(g, func() {
+		assert.Nil(t, g.countdown)
+	})
+
+	table.send("Al", setReadyRequest{Ready: true})
+	table.time.advance(5 * time.Second)
+	withLock(g, func() {
+		assert.Equal(t, gameStateRunning, g.state)
+		assert.False(t, g.players.GetByName("Al").IsReady)
+	})
+}
+
+func TestCountdownWaitsForJoins(t *testing.T) {
+	rules := DefaultRules()
+	rules.StartCountdown = 5 * time.Second
+	g, table := newTestTable(rules, "Al", "Bo")
+	table.send("Al", setReadyRequest{Ready: true})
+	table.send("Bo", setReadyRequest{Ready: true})
+
+	// opening the page or watching does not cancel the countdown, but joining does
+	g.ConnectionStateChanged(uuid.New(), &testSink{}, connStateNew)
+	g.ConnectionStateChanged(uuid.New(), &testSink{}, connStateWatch)
+	withLock(g, func() {
+		assert.NotNil(t, g.countdown)
+	})
+	table.join("Cy")
+	withLock(g, func() {
+		assert.Nil(t, g.countdown)
+	})
+}
+
+func TestCountdownRechecksTable(t *testing.T) {
+	rules := DefaultRules()
+	rules.StartCountdown = 5 * time.Second
+	g, table := newTestTable(rules, "Al", "Bo")
+	table.send("Al", setReadyRequest{Ready: true})
+	table.send("Bo", setReadyRequest{Ready: true})
+
+	// the game does not start if the table is no longer ready when the
+	// countdown ends, even though the countdown was not cancelled
+	withLock(g, func() {
+		g.players.GetByName("Bo").IsReady = false
+	})
+	table.time.advance(5 * time.Second)
+	withLock(g, func() {
+		assert.Equal(t, gameStateInLobby, g.state)
+		assert.Nil(t, g.countdown)
+	})
+}
+
+func TestPauseAndResume(t *testing.T) {
+	rules := DefaultRules()
+	rules.PauseLimit = 1
+	g, table := newTestTable(rules, "Al", "Bo")
+	table.start()
+
+	table.send("Al", pauseGameRequest{})
+	withLock(g, func() {
+		assert.Equal(t, gameStatePaused, g.state)
+	})
+
+	// only the player who paused may resume
+	table.send("Bo", resumeGameRequest{})
+	responses := table.responses("Bo")
+	assert.Equal(t, errorResponse{Kind: errKindNotAuthorised}, responses[len(responses)-1])
+
+	table.send("Al", resumeGameRequest{})
+	withLock(g, func() {
+		assert.Equal(t, gameStateRunning, g.state)
+	})
+
+	table.send("Al", pauseGameRequest{})
+	responses = table.responses("Al")
+	assert.Equal(t, errorResponse{Kind: errKindNoPausesLeft}, responses[len(responses)-1])
+}
+
+func TestLeaveGame(t *testing.T) {
+	g, table := newTestTable(DefaultRules(), "Al", "Bo", "Cy")
+	table.start()
+	table.send("Bo", leaveGameRequest{})
+
+	withLock(g, func() {
+		assert.Equal(t, gameStateRunning, g.state)
+		assert.True(t, g.players.GetByName("Bo").Forfeited)
+	})
+	assert.False(t, g.IsAcceptingConnections())
+
+	// the seat cannot be taken back by re-joining with the same name
+	table.join("Bo")
+	assert.Equal(t, errorResponse{Kind: errKindGameFull}, table.responses("Bo")[0])
+}
+
+func TestRequestAcknowledgement(t *testing.T) {
+	g := NewGame(DefaultRules())
+
+	al, sink := joinTestPlayer(g, "Al")
+	g.ProcessRequest(al, "1", changeNameRequest{PlayerName: "Alf"}, reflect.TypeOf(changeNameRequest{}))
+	g.ProcessRequest(al, "2", startGameRequest{}, reflect.TypeOf(startGameRequest{}))
+
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	assert.Contains(t, sink.responses, ackResponse{RequestID: "1"})
+	assert.Equal(t, errorResponse{Kind: errKindNotAuthorised, RequestID: "2"}, sink.responses[len(sink.responses)-1])
+}
+
+func TestPlayTurnErrorDetails(t *testing.T) {
+	g, _ := newTestTable(DefaultRules(), "Al", "Bo")
+
+	withLock(g, func() {
+		g.startGame(g.players[0])
+		thePlayer := g.players.CurrentTurn()
+		lowest := globalRankSort(thePlayer.Hand)[0]
+		highest := globalRankSort(thePlayer.Hand)[12]
+
+		err := g.playTurn(thePlayer, []int{highest.GlobalRank})
+		assert.Equal(t, &errorResponse{Kind: errKindMustPlayLowest, Details: &errorDetails{MustInclude: &lowest}}, err)
+
+		err = g.playTurn(thePlayer, []int{lowest.GlobalRank, 99})
+		assert.Equal(t, &errorResponse{Kind: errKindInvalidCards, Details: &errorDetails{Cards: []int{99}}}, err)
+
+		err = g.playTurn(thePlayer, []int{lowest.GlobalRank, highest.GlobalRank})
+		assert.Equal(t, &errorResponse{
+			Kind:    errKindInvalidPattern,
+			Details: &errorDetails{Pattern: patternInvalid, Cards: []int{lowest.GlobalRank, highest.GlobalRank}},
+		}, err)
+	})
+}
+
+func TestStateDeltas(t *testing.T) {
+	_, table := newTestTable(DefaultRules(), "Al", "Bo")
+	table.send("Al", syncStateRequest{Deltas: true})
+	table.start()
+
+	var full gameStateRefreshResponse
+	var delta gameStateDeltaResponse
+	for _, response := range table.responses("Al") {
+		switch r := response.(type) {
+		case gameStateRefreshResponse:
+			full = r
+		case gameStateDeltaResponse:
+			delta = r
+		}
+	}
+	assert.Equal(t, full.Version, delta.BaseVersion)
+	assert.Equal(t, full.Version+1, delta.Version)
+	assert.Equal(t, json.RawMessage(`2`), delta.Changes["gameState"])
+	assert.NotContains(t, delta.Changes, "winPlaces")
+}
+
+func TestEventReplay(t *testing.T) {
+	g, table := newTestTable(DefaultRules(), "Al", "Bo", "Cy")
+	table.start()
+	boSink := table.sinks["Bo"]
+	boSink.mutex.Lock()
+	lastSeq := boSink.lastSeq
+	boSink.mutex.Unlock()
+	g.ConnectionStateChanged(table.conns["Bo"], boSink, connStateDead)
+
+	// Bo missed hearing that they disconnected and the game paused
+	rejoin := func(lastSeq int) *testSink {
+		connID := uuid.New()
+		sink := &testSink{}
+		g.ConnectionStateChanged(connID, sink, connStateNew)
+		g.ProcessRequest(connID, "", joinGameRequest{PlayerName: "Bo", LastEventSeq: &lastSeq}, reflect.TypeOf(joinGameRequest{}))
+		g.ConnectionStateChanged(connID, sink, connStateDead)
+		return sink
+	}
+	sink := rejoin(lastSeq)
+	sink.mutex.Lock()
+	assert.IsType(t, playerDisconnectedResponse{}, sink.responses[0])
+	assert.IsType(t, gamePausedResponse{}, sink.responses[1])
+	assert.Equal(t, eventsReplayedResponse{Count: 2, Complete: true}, sink.responses[2])
+	assert.IsType(t, playerJoinedResponse{}, sink.responses[3])
+	sink.mutex.Unlock()
+
+	// events that are no longer kept cannot be replayed
+	withLock(g, func() {
+		for i := 0; i < maxEventHistory; i++ {
+			g.sendToAllPlayers(gameResumedResponse{})
+		}
+	})
+	sink = rejoin(lastSeq)
+	sink.mutex.Lock()
+	assert.Equal(t, eventsReplayedResponse{Count: maxEventHistory, Complete: false}, sink.responses[maxEventHistory])
+	sink.mutex.Unlock()
+}
+
+func TestHelloHandshake(t *testing.T) {
+	g := NewGame(DefaultRules())
+
+	connID := uuid.New()
+	sink := &testSink{}
+	g.ConnectionStateChanged(connID, sink, connStateNew)
+	g.ProcessRequest(connID, "", helloRequest{ProtocolVersion: protocolVersion, Features: []string{featureStateDeltas}}, reflect.TypeOf(helloRequest{}))
+	g.ProcessRequest(connID, "", joinGameRequest{PlayerName: "Al"}, reflect.TypeOf(joinGameRequest{}))
+	g.ProcessRequest(connID, "", helloRequest{ProtocolVersion: protocolVersion}, reflect.TypeOf(helloRequest{}))
+
+	sink.mutex.Lock()
+	hello := sink.responses[0].(helloResponse)
+	assert.Equal(t, protocolVersion, hello.ProtocolVersion)
+	assert.Equal(t, "wait", hello.Rules.DisconnectAction)
+	assert.Contains(t, hello.Features, featureHints)
+	assert.NotContains(t, hello.Features, featureTurnClock)
+	assert.Equal(t, errorResponse{Kind: errKindNotAuthorised}, sink.responses[len(sink.responses)-1])
+	sink.mutex.Unlock()
+	withLock(g, func() {
+		assert.True(t, g.connections[connID.String()].deltas)
+	})
+
+	// clients with a protocol version the server does not support are turned away
+	connID = uuid.New()
+	sink = &testSink{}
+	g.ConnectionStateChanged(connID, sink, connStateNew)
+	g.ProcessRequest(connID, "", helloRequest{ProtocolVersion: protocolVersion + 1}, reflect.TypeOf(helloRequest{}))
+	sink.mutex.Lock()
+	assert.Equal(t, errorResponse{Kind: errKindIncompatible, Details: &errorDetails{
+		MinProtocolVersion: minProtocolVersion,
+		MaxProtocolVersion: protocolVersion,
+	}}, sink.responses[0])
+	sink.mutex.Unlock()
+}
+
+func TestLatencyReporting(t *testing.T) {
+	g := NewGame(DefaultRules())
+	al, sink := joinTestPlayer(g, "Al")
+
+	count := func() int {
+		sink.mutex.Lock()
+		defer sink.mutex.Unlock()
+		return len(sink.responses)
+	}
+	before := count()
+	g.LatencyMeasured(al, 40*time.Millisecond)
+	assert.Equal(t, before, count())
+
+	// big changes are sent to everyone straight away
+	g.LatencyMeasured(al, 300*time.Millisecond)
+	assert.Equal(t, before+1, count())
+	sink.mutex.Lock()
+	assert.Equal(t, int64(300), sink.responses[before].(gameStateRefreshResponse).Self.LatencyMs)
+	sink.mutex.Unlock()
+}
+
+func TestHintRequest(t *testing.T) {
+	rules := DefaultRules()
+	rules.HintCooldown = 10 * time.Second
+	g, table := newTestTable(rules, "Al", "Bo")
+	table.start()
+
+	var first *player
+	var name string
+	var lowest card
+	withLock(g, func() {
+		first = g.players.CurrentTurn()
+		name = first.Name
+		lowest = globalRankSort(first.Hand)[0]
+	})
+	lastResponse := func() interface{} {
+		responses := table.responses(name)
+		return responses[len(responses)-1]
+	}
+
+	// the first play of the game must include the lowest card
+	table.send(name, hintRequest{})
+	assert.Equal(t, 1, table.count(name, hintResponse{}))
+	var hint hintResponse
+	for _, response := range table.responses(name) {
+		if r, ok := response.(hintResponse); ok {
+			hint = r
+		}
+	}
+	assert.NotEmpty(t, hint.Plays)
+	assert.False(t, hint.Pass)
+	for _, play := range hint.Plays {
+		assert.NotEqual(t, -1, cardInSet(lowest.GlobalRank, play), "%+v", play)
+	}
+	assert.IsType(t, gameStateRefreshResponse{}, lastResponse())
+
+	// another hint must wait for the cooldown
+	table.time.advance(4 * time.Second)
+	table.send(name, hintRequest{})
+	assert.Equal(t, errorResponse{Kind: errKindHintCooldown, Details: &errorDetails{RetryAfterMs: 6000}}, lastResponse())
+	withLock(g, func() {
+		assert.Equal(t, 1, first.HintsUsed)
+	})
+
+	table.time.advance(6 * time.Second)
+	table.send(name, hintRequest{})
+	assert.Equal(t, 2, table.count(name, hintResponse{}))
+	withLock(g, func() {
+		assert.Equal(t, 2, first.HintsUsed)
+	})
+}
+
+func TestHintsDisabled(t *testing.T) {
+	rules := DefaultRules()
+	rules.HintsEnabled = false
+	g, table := newTestTable(rules, "Al", "Bo")
+	table.start()
+
+	var first *player
+	var name string
+	withLock(g, func() {
+		first = g.players.CurrentTurn()
+		name = first.Name
+	})
+	table.send(name, hintRequest{})
+	responses := table.responses(name)
+	assert.Equal(t, errorResponse{Kind: errKindHintsDisabled}, responses[len(responses)-1])
+	assert.Zero(t, table.count(name, hintResponse{}))
+	withLock(g, func() {
+		assert.Zero(t, first.HintsUsed)
+	})
+}
+
+func TestArrangeHand(t *testing.T) {
+	g, table := newTestTable(DefaultRules(), "Al", "Bo")
+	table.start()
+
+	var al *player
+	var order []int
+	withLock(g, func() {
+		al = g.players.GetByName("Al")
+		for _, c := range al.Hand {
+			order = append([]int{c.GlobalRank}, order...)
+		}
+	})
+
+	// without cards, ways to arrange the hand are suggested
+	table.send("Al", arrangeHandRequest{})
+	assert.Equal(t, 1, table.count("Al", handArrangementResponse{}))
+
+	// a valid arrangement is kept
+	table.send("Al", arrangeHandRequest{Cards: order})
+	withLock(g, func() {
+		arranged := []int{}
+		for _, c := range al.Hand {
+			arranged = append(arranged, c.GlobalRank)
+		}
+		assert.Equal(t, order, arranged)
+	})
+	responses := table.responses("Al")
+	assert.Equal(t, order[0], responses[len(responses)-1].(gameStateRefreshResponse).SelfHand[0].GlobalRank)
+}
+
+func TestArrangeHandRejectsOtherCards(t *testing.T) {
+	g, table := newTestTable(DefaultRules(), "Al", "Bo")
+	table.start()
+
+	var hand []card
+	var order []int
+	withLock(g, func() {
+		hand = append(hand, g.players.GetByName("Al").Hand...)
+		for _, c := range hand {
+			order = append(order, c.GlobalRank)
+		}
+	})
+	notHeld := 0
+	for rank := 1; rank <= 52 && notHeld == 0; rank++ {
+		if cardInSet(rank, hand) == -1 {
+			notHeld = rank
+		}
+	}
+
+	cases := map[string]struct {
+		cards   []int
+		invalid []int
+	}{
+		"missing":   {order[1:], []int{order[0]}},
+		"extra":     {append(append([]int(nil), order...), notHeld), []int{notHeld}},
+		"duplicate": {append(append([]int(nil), order[1:]...), order[1]), []int{order[1], order[0]}},
+		"swapped":   {append(append([]int(nil), order[1:]...), notHeld), []int{notHeld, order[0]}},
+	}
+	for name, c := range cases {
+		table.send("Al", arrangeHandRequest{Cards: c.cards})
+		responses := table.responses("Al")
+		assert.Equal(t, errorResponse{Kind: errKindInvalidCards, Details: &errorDetails{Cards: c.invalid}}, responses[len(responses)-1], name)
+	}
+	withLock(g, func() {
+		assert.Equal(t, hand, g.players.GetByName("Al").Hand)
+	})
+}
@@ -0,0 +1,134 @@
+package game
+
+import "sort"
+
+const maxHintPlays = 3
+
+// returns the cards grouped by face value, indexed by suit rank (1 = "2", 13 = "3").
+// Cards within each group are sorted by global rank, lowest to highest.
+func groupBySuitRank(hand []card) [14][]card {
+	groups := [14][]card{}
+	for _, c := range hand {
+		// insertion sort, as each group has at most 4 cards
+		group := append(groups[c.SuitRank], c)
+		i := len(group) - 1
+		for ; i > 0 && group[i-1].GlobalRank < c.GlobalRank; i-- {
+			group[i] = group[i-1]
+		}
+		group[i] = c
+		groups[c.SuitRank] = group
+	}
+	return groups
+}
+
+// returns every subset of exactly size n of the cards, preserving order
+func combinations(cards []card, n int) [][]card {
+	if n == 0 {
+		return [][]card{{}}
+	}
+	if len(cards) < n {
+		return nil
+	}
+	combos := [][]card{}
+	for i := 0; i <= len(cards)-n; i++ {
+		for _, rest := range combinations(cards[i+1:], n-1) {
+			combo := append([]card{cards[i]}, rest...)
+			combos = append(combos, combo)
+		}
+	}
+	return combos
+}
+
+// a play along with its already-known pattern
+type patternedPlay struct {
+	Cards   []card
+	Pattern pattern
+}
+
+// returns every distinct play that can be made from the hand. For sequences, only
+// the top face value is varied by suit (it alone decides what the sequence beats),
+// while the lower face values always use their lowest cards.
+func allPlays(hand []card) []patternedPlay {
+	groups := groupBySuitRank(hand)
+	plays := []patternedPlay{}
+
+	// of a kind
+	ofAKind := [5]pattern{patternInvalid, patternSingle, patternDouble, patternTriple, patternQuad}
+	for rank := 13; rank >= 1; rank-- {
+		for size := 1; size <= len(groups[rank]); size++ {
+			for _, play := range combinations(groups[rank], size) {
+				plays = append(plays, patternedPlay{Cards: play, Pattern: ofAKind[size]})
+			}
+		}
+	}
+
+	// sequences, which run from a low suit rank downwards and cannot include 2's
+	sequences := [5]pattern{patternInvalid, patternSeqSingles, patternSeqDoubles, patternSeqTriples, patternSeqQuads}
+	for size := 1; size <= 4; size++ {
+		for low := 13; low >= 4; low-- {
+			base := []card{}
+			for top := low; top >= 2 && len(groups[top]) >= size; top-- {
+				if low-top >= 2 {
+					for _, topCards := range combinations(groups[top], size) {
+						play := append(append([]card(nil), base...), topCards...)
+						plays = append(plays, patternedPlay{Cards: play, Pattern: sequences[size]})
+					}
+				}
+				base = append(base, groups[top][:size]...)
+			}
+		}
+	}
+
+	return plays
+}
+
+// returns the plays from the hand that may legally follow the last played cards.
+// If mustInclude is not nil, only plays containing that card are returned.
+func legalPlays(hand, lastPlayed []card, newRound bool, mustInclude *card) [][]card {
+	lastPattern := patternInvalid
+	if !newRound {
+		lastPattern = determinePattern(lastPlayed)
+	}
+
+	legal := [][]card{}
+	for _, play := range allPlays(hand) {
+		if !newRound && !beatsWithPatterns(play.Cards, play.Pattern, lastPlayed, lastPattern) {
+			continue
+		}
+		if mustInclude != nil && cardInSet(mustInclude.GlobalRank, play.Cards) == -1 {
+			continue
+		}
+		legal = append(legal, play.Cards)
+	}
+	return legal
+}
+
+// returns the global rank of the highest card in a play
+func topRank(play []card) int {
+	top := play[0].GlobalRank
+	for _, c := range play[1:] {
+		if c.GlobalRank < top {
+			top = c.GlobalRank
+		}
+	}
+	return top
+}
+
+// returns up to max plays, preferring those that use the weakest top card and
+// then those that shed the most cards
+func suggestPlays(plays [][]card, max int) [][]card {
+	ranked := append([][]card(nil), plays...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if topRank(ranked[i]) != topRank(ranked[j]) {
+			return topRank(ranked[i]) > topRank(ranked[j])
+		}
+		return len(ranked[i]) > len(ranked[j])
+	})
+	if len(ranked) > max {
+		ranked = ranked[:max]
+	}
+	for i := range ranked {
+		ranked[i] = globalRankSort(ranked[i])
+	}
+	return ranked
+}
@@ -0,0 +1,64 @@
+package game
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllPlays(t *testing.T) {
+	hand := []card{
+		{Suit: suitSpades, FaceValue: 3, SuitRank: 13, GlobalRank: 52},
+		{Suit: suitClubs, FaceValue: 3, SuitRank: 13, GlobalRank: 51},
+		{Suit: suitSpades, FaceValue: 4, SuitRank: 12, GlobalRank: 48},
+		{Suit: suitHearts, FaceValue: 5, SuitRank: 11, GlobalRank: 41},
+		{Suit: suitHearts, FaceValue: 2, SuitRank: 1, GlobalRank: 1},
+	}
+	plays := allPlays(hand)
+
+	// 5 singles, 1 pair and the 3-4-5 sequence
+	assert.Equal(t, 7, len(plays))
+	for _, play := range plays {
+		assert.Equal(t, play.Pattern, determinePattern(play.Cards), "%+v", play)
+	}
+}
+
+func TestLegalPlays(t *testing.T) {
+	hand := []card{
+		{Suit: suitSpades, FaceValue: 3, SuitRank: 13, GlobalRank: 52},
+		{Suit: suitClubs, FaceValue: 4, SuitRank: 12, GlobalRank: 47},
+		{Suit: suitSpades, FaceValue: 5, SuitRank: 11, GlobalRank: 44},
+		{Suit: suitHearts, FaceValue: 5, SuitRank: 11, GlobalRank: 41},
+		{Suit: suitHearts, FaceValue: 2, SuitRank: 1, GlobalRank: 1},
+	}
+
+	// new round, must include the 3 of spades
+	plays := legalPlays(hand, nil, true, &hand[0])
+	assert.Equal(t, 3, len(plays))
+	for _, play := range plays {
+		assert.NotEqual(t, -1, cardInSet(52, play))
+	}
+
+	// must beat a single 5 of diamonds
+	lastPlayed := []card{{Suit: suitDiamonds, FaceValue: 5, SuitRank: 11, GlobalRank: 42}}
+	plays = legalPlays(hand, lastPlayed, false, nil)
+	assert.Equal(t, [][]card{{hand[3]}, {hand[4]}}, plays)
+
+	// nothing beats a pair of 2's
+	lastPlayed = []card{
+		{Suit: suitSpades, FaceValue: 2, SuitRank: 1, GlobalRank: 4},
+		{Suit: suitClubs, FaceValue: 2, SuitRank: 1, GlobalRank: 3},
+	}
+	assert.Empty(t, legalPlays(hand, lastPlayed, false, nil))
+}
+
+func TestSuggestPlays(t *testing.T) {
+	plays := [][]card{
+		{{FaceValue: 2, SuitRank: 1, GlobalRank: 1}},
+		{{FaceValue: 4, SuitRank: 12, GlobalRank: 47}},
+		{{FaceValue: 3, SuitRank: 13, GlobalRank: 52}, {FaceValue: 4, SuitRank: 12, GlobalRank: 47}, {FaceValue: 5, SuitRank: 11, GlobalRank: 44}},
+		{{FaceValue: 5, SuitRank: 11, GlobalRank: 44}},
+	}
+	suggested := suggestPlays(plays, 2)
+	assert.Equal(t, [][]card{plays[1], plays[2]}, suggested)
+}
@@ -0,0 +1,223 @@
+package game
+
+import (
+	"encoding/json"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	dropStrikes       = 3                // messages over the limit in a row that are silently dropped
+	disconnectStrikes = 20               // ... after which the connection is closed, with errors in between
+	idleBucketTimeout = 10 * time.Minute // addresses not heard from for this long are forgotten
+)
+
+// Limits holds how much clients may send, beyond which messages are refused
+type Limits struct {
+	MessageRate    float64 // messages per second for a single connection
+	MessageBurst   int     // messages a connection may send at once
+	AddressRate    float64 // messages per second for all connections from one IP address
+	AddressBurst   int
+	MaxMessageSize int64 // bytes
+}
+
+// DefaultLimits returns the limits used when none are specified
+func DefaultLimits() Limits {
+	return Limits{
+		MessageRate:    10,
+		MessageBurst:   20,
+		AddressRate:    30,
+		AddressBurst:   60,
+		MaxMessageSize: 16 * 1024,
+	}
+}
+
+// LimitStats counts how often the limits have been hit
+type LimitStats struct {
+	Dropped      int64 `json:"dropped"`      // messages ignored
+	Rejected     int64 `json:"rejected"`     // messages answered with an error
+	Disconnected int64 `json:"disconnected"` // connections closed for flooding
+	Oversized    int64 `json:"oversized"`    // messages over the size limit, which also close the connection
+}
+
+// Limiter applies the limits across all connections
+type Limiter struct {
+	limits    Limits
+	mutex     sync.Mutex
+	addresses map[string]*tokenBucket
+	lastSweep time.Time
+	stats     LimitStats
+}
+
+// NewLimiter builds a limiter for the given limits
+func NewLimiter(limits Limits) *Limiter {
+	return &Limiter{limits: limits, addresses: map[string]*tokenBucket{}}
+}
+
+// Stats returns how often the limits have been hit so far
+func (l *Limiter) Stats() LimitStats {
+	return LimitStats{
+		Dropped:      atomic.LoadInt64(&l.stats.Dropped),
+		Rejected:     atomic.LoadInt64(&l.stats.Rejected),
+		Disconnected: atomic.LoadInt64(&l.stats.Disconnected),
+		Oversized:    atomic.LoadInt64(&l.stats.Oversized),
+	}
+}
+
+// StatsHandler serves the limit counters as JSON
+func (l *Limiter) StatsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(l.Stats())
+}
+
+// starts limiting a new connection from the address of the request
+func (l *Limiter) forConnection(r *http.Request) *connLimiter {
+	return &connLimiter{
+		limiter: l,
+		address: addressOf(r),
+		bucket:  newTokenBucket(l.limits.MessageRate, l.limits.MessageBurst),
+	}
+}
+
+// decides whether a stream may be opened now from the address of the request,
+// returning how long until one may be if not. Opening a stream counts against
+// the address like a message.
+func (l *Limiter) checkStream(r *http.Request, now time.Time) time.Duration {
+	wait := l.takeForAddress(addressOf(r), now)
+	if wait > 0 {
+		atomic.AddInt64(&l.stats.Rejected, 1)
+	}
+	return wait
+}
+
+// returns the IP address a request came from
+func addressOf(r *http.Request) string {
+	address, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		address = r.RemoteAddr
+	}
+	return address
+}
+
+// takes a token for the address, returning how long until one is free if there is none
+func (l *Limiter) takeForAddress(address string, now time.Time) time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if now.Sub(l.lastSweep) > time.Minute {
+		for a, bucket := range l.addresses {
+			if now.Sub(bucket.last) > idleBucketTimeout {
+				delete(l.addresses, a)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	bucket := l.addresses[address]
+	if bucket == nil {
+		bucket = newTokenBucket(l.limits.AddressRate, l.limits.AddressBurst)
+		l.addresses[address] = bucket
+	}
+	return bucket.take(now)
+}
+
+func (l *Limiter) countOversized() {
+	atomic.AddInt64(&l.stats.Oversized, 1)
+}
+
+// what happens to a message from a connection
+type verdict int
+
+const (
+	verdictAllow      verdict = 1
+	verdictDrop       verdict = 2
+	verdictReject     verdict = 3 // answered with an error
+	verdictDisconnect verdict = 4
+)
+
+// limits a single connection, escalating while it keeps going over the limit
+type connLimiter struct {
+	mutex   sync.Mutex
+	limiter *Limiter
+	address string
+	bucket  *tokenBucket
+	strikes int // messages over the limit in a row
+}
+
+// decides what happens to a message received now, and if it is refused, how
+// long until the connection may send again
+func (c *connLimiter) check(now time.Time) (verdict, time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// the address is checked first, so that a message it refuses does not
+	// use up the connection's own allowance
+	wait := c.limiter.takeForAddress(c.address, now)
+	if wait == 0 {
+		wait = c.bucket.take(now)
+	}
+	if wait == 0 {
+		c.strikes = 0
+		return verdictAllow, 0
+	}
+
+	c.strikes++
+	switch {
+	case c.strikes <= dropStrikes:
+		atomic.AddInt64(&c.limiter.stats.Dropped, 1)
+		return verdictDrop, wait
+	case c.strikes < disconnectStrikes:
+		atomic.AddInt64(&c.limiter.stats.Rejected, 1)
+		return verdictReject, wait
+	default:
+		atomic.AddInt64(&c.limiter.stats.Disconnected, 1)
+		return verdictDisconnect, wait
+	}
+}
+
+// the Retry-After header value for a refused request
+func retryAfter(wait time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(wait.Seconds())))
+}
+
+// the error a refused message is answered with, tagged with its request ID
+func rateLimitedError(wait time.Duration, requestID string) errorResponse {
+	return errorResponse{
+		Kind:      errKindRateLimited,
+		RequestID: requestID,
+		Details:   &errorDetails{RetryAfterMs: wait.Milliseconds() + 1},
+	}
+}
+
+// holds up to burst tokens, refilled at rate per second
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+// takes a token, returning how long until one is free if there is none
+func (b *tokenBucket) take(now time.Time) time.Duration {
+	if !b.last.IsZero() {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	if b.rate <= 0 {
+		return time.Hour
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
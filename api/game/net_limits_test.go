@@ -0,0 +1,139 @@
+package game
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	bucket := newTokenBucket(2, 3)
+	for i := 0; i < 3; i++ {
+		assert.Zero(t, bucket.take(now))
+	}
+	assert.Equal(t, 500*time.Millisecond, bucket.take(now))
+
+	// refills at the rate, up to the burst
+	assert.Zero(t, bucket.take(now.Add(500*time.Millisecond)))
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		assert.Zero(t, bucket.take(now))
+	}
+	assert.NotZero(t, bucket.take(now))
+}
+
+func TestRateLimitEscalation(t *testing.T) {
+	limiter := NewLimiter(Limits{MessageRate: 1, MessageBurst: 1, AddressRate: 100, AddressBurst: 100})
+	limits := limiter.forConnection(httptest.NewRequest(http.MethodGet, "/", nil))
+
+	now := time.Now()
+	verdicts := []verdict{}
+	for i := 0; i <= disconnectStrikes; i++ {
+		verdict, _ := limits.check(now)
+		verdicts = append(verdicts, verdict)
+	}
+	assert.Equal(t, verdictAllow, verdicts[0])
+	assert.Equal(t, verdictDrop, verdicts[dropStrikes])
+	assert.Equal(t, verdictReject, verdicts[dropStrikes+1])
+	assert.Equal(t, verdictDisconnect, verdicts[disconnectStrikes])
+	assert.Equal(t, LimitStats{Dropped: dropStrikes, Rejected: disconnectStrikes - dropStrikes - 1, Disconnected: 1}, limiter.Stats())
+
+	// going back under the limit starts over
+	verdict, _ := limits.check(now.Add(time.Second))
+	assert.Equal(t, verdictAllow, verdict)
+	verdict, _ = limits.check(now.Add(time.Second))
+	assert.Equal(t, verdictDrop, verdict)
+
+	// connections from the same address share its limit
+	limiter = NewLimiter(Limits{MessageRate: 100, MessageBurst: 100, AddressRate: 1, AddressBurst: 1})
+	first := limiter.forConnection(httptest.NewRequest(http.MethodGet, "/", nil))
+	second := limiter.forConnection(httptest.NewRequest(http.MethodGet, "/", nil))
+	verdict, _ = first.check(now)
+	assert.Equal(t, verdictAllow, verdict)
+	verdict, _ = second.check(now)
+	assert.Equal(t, verdictDrop, verdict)
+
+	// a message the address refuses does not use up the connection's allowance
+	limiter = NewLimiter(Limits{MessageRate: 0.001, MessageBurst: 1, AddressRate: 1, AddressBurst: 1})
+	first = limiter.forConnection(httptest.NewRequest(http.MethodGet, "/", nil))
+	second = limiter.forConnection(httptest.NewRequest(http.MethodGet, "/", nil))
+	verdict, _ = first.check(now)
+	assert.Equal(t, verdictAllow, verdict)
+	verdict, _ = second.check(now)
+	assert.Equal(t, verdictDrop, verdict)
+	verdict, _ = second.check(now.Add(time.Second))
+	assert.Equal(t, verdictAllow, verdict)
+}
+
+func TestPollRateLimit(t *testing.T) {
+	g := NewGame(DefaultRules())
+	limits := DefaultLimits()
+	limits.MessageBurst, limits.MaxMessageSize = 1, 100
+	server := httptest.NewServer(http.HandlerFunc(PollHandler(g, NewLimiter(limits))))
+	defer server.Close()
+
+	resp, err := http.Post(server.URL, "application/json", nil)
+	assert.Nil(t, err)
+	session := struct{ Session string }{}
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(&session))
+	resp.Body.Close()
+	url := server.URL + "?session=" + session.Session
+
+	resp, err = http.Post(url, "application/json", strings.NewReader(strings.Repeat(" ", 101)))
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+
+	statuses := []int{}
+	for i := 0; i < 2; i++ {
+		resp, err = http.Post(url, "application/json", strings.NewReader(`{"kind":"START_GAME","data":"e30="}`))
+		assert.Nil(t, err)
+		resp.Body.Close()
+		statuses = append(statuses, resp.StatusCode)
+	}
+	assert.Equal(t, []int{http.StatusNoContent, http.StatusTooManyRequests}, statuses)
+	assert.NotEmpty(t, resp.Header.Get("Retry-After"))
+
+	// once past the dropped messages, refusals are tagged with the request ID
+	for i := 1; i <= dropStrikes; i++ {
+		resp, err = http.Post(url, "application/json", strings.NewReader(`{"kind":"START_GAME","id":"7","data":"e30="}`))
+		assert.Nil(t, err)
+		if i < dropStrikes {
+			resp.Body.Close()
+		}
+	}
+	defer resp.Body.Close()
+	message := Message{}
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(&message))
+	data, err := base64.StdEncoding.DecodeString(message.Data)
+	assert.Nil(t, err)
+	refusal := struct {
+		Code      string `json:"code"`
+		RequestID string `json:"requestId"`
+	}{}
+	assert.Nil(t, json.Unmarshal(data, &refusal))
+	assert.Equal(t, "RATE_LIMITED", refusal.Code)
+	assert.Equal(t, "7", refusal.RequestID)
+}
+
+func TestObserverRateLimit(t *testing.T) {
+	limits := DefaultLimits()
+	limits.AddressRate, limits.AddressBurst = 0.001, 1
+	limiter := NewLimiter(limits)
+	handler := ObserverHandler(NewGame(DefaultRules()), limiter)
+
+	// the first stream uses up the address's allowance, so the next is refused
+	assert.Zero(t, limiter.checkStream(httptest.NewRequest(http.MethodGet, "/", nil), time.Now()))
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	assert.NotEmpty(t, recorder.Header().Get("Retry-After"))
+	assert.Equal(t, int64(1), limiter.Stats().Rejected)
+}
@@ -1,15 +1,78 @@
 package game
 
+import (
+	"encoding/json"
+	"time"
+)
+
 // Message represents a request or response that can travel over a connection
 type Message struct {
 	Kind string `json:"kind"`
+	// ID optionally identifies a request, and is echoed on the ACK or ERROR response to it
+	ID string `json:"id,omitempty"`
+	// Seq numbers the events broadcast in a room, so a reconnecting player can ask for those they missed
+	Seq int `json:"seq,omitempty"`
 	// Data is a base64-encoded JSON string whose decoded bytes can be marshalled into a request or response type
 	Data string `json:"data"`
 }
 
-// links a new connection with a player
+// MessageV2 is a Message for the "json.v2" subprotocol, whose data is embedded as-is
+type MessageV2 struct {
+	Kind string          `json:"kind"`
+	ID   string          `json:"id,omitempty"`
+	Seq  int             `json:"seq,omitempty"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// announces what a client supports, before it joins the game. Features are the
+// optional behaviours it wants, e.g. "stateDeltas".
+type helloRequest struct {
+	ProtocolVersion int      `json:"protocolVersion"`
+	Features        []string `json:"features"`
+}
+
+// tells a client what the server supports, and the rules the game is played with
+type helloResponse struct {
+	ProtocolVersion    int       `json:"protocolVersion"`
+	MinProtocolVersion int       `json:"minProtocolVersion"` // ... a client may use
+	Rules              rulesInfo `json:"rules"`
+	Features           []string  `json:"features"`
+}
+
+// the rule variants a game is played with, as told to clients
+type rulesInfo struct {
+	HintsEnabled      bool   `json:"hintsEnabled"`
+	HintCooldownMs    int64  `json:"hintCooldownMs"`
+	DisconnectAction  string `json:"disconnectAction"` // wait, bot, forfeit or abandon
+	DisconnectGraceMs int64  `json:"disconnectGraceMs"`
+	TurnTimeLimitMs   int64  `json:"turnTimeLimitMs,omitempty"`
+	TimeBankMs        int64  `json:"timeBankMs,omitempty"`
+	TimeIncrementMs   int64  `json:"timeIncrementMs,omitempty"`
+	TimeoutAction     string `json:"timeoutAction"` // pass, bot or forfeit
+	StartCountdownMs  int64  `json:"startCountdownMs"`
+	PauseLimit        int    `json:"pauseLimit"`
+	PauseHostOnly     bool   `json:"pauseHostOnly"`
+}
+
+// links a new connection with a player. A player re-joining a game can give
+// the sequence of the last event they saw to be sent the events they missed.
 type joinGameRequest struct {
-	PlayerName string `json:"playerName"`
+	PlayerName   string `json:"playerName"`
+	LastEventSeq *int   `json:"lastEventSeq,omitempty"`
+}
+
+// an event broadcast to players along with its place in the room's history
+type sequencedEvent struct {
+	Seq      int
+	Response interface{}
+}
+
+// informs a re-joining player that the missed events have been re-sent.
+// Complete is false if some were too old to be kept, in which case the state
+// refresh that follows is all there is to go on.
+type eventsReplayedResponse struct {
+	Count    int  `json:"count"`
+	Complete bool `json:"complete"`
 }
 
 // informs all players of a newly-connected player
@@ -17,9 +80,17 @@ type playerJoinedResponse struct {
 	Player player `json:"player"`
 }
 
+// gives up the player's seat for good, rather than just disconnecting
+type leaveGameRequest struct{}
+
+// informs all players that a player has given up their seat
+type playerLeftResponse struct {
+	Player player `json:"player" bin:"seat"`
+}
+
 // informs all players of a disconnection event
 type playerDisconnectedResponse struct {
-	Player player `json:"player"`
+	Player player `json:"player" bin:"seat"`
 }
 
 // starts a ready game
@@ -27,26 +98,42 @@ type startGameRequest struct{}
 
 // informs all players that the game has started
 type gameStartedResponse struct {
-	Player player `json:"player"`
+	Player player `json:"player" bin:"seat"`
 }
 
+// pauses the running game, e.g. when a player needs to step away
+type pauseGameRequest struct{}
+
+// resumes a game paused with pauseGameRequest
+type resumeGameRequest struct{}
+
 // informs all players that the game is paused
-type gamePausedResponse struct{}
+type gamePausedResponse struct {
+	Player   *player    `json:"player,omitempty" bin:"seat"` // who asked for the pause, if it was not a disconnect
+	Deadline *time.Time `json:"deadline,omitempty"`          // when the disconnect action applies, if the player has not returned
+}
+
+// informs all players that the game was abandoned because a player did not return
+type gameAbandonedResponse struct {
+	Player player `json:"player" bin:"seat"`
+}
 
 // informs all players that the paused game has resumed
-type gameResumedResponse struct{}
+type gameResumedResponse struct {
+	Player *player `json:"player,omitempty" bin:"seat"` // who asked to resume, if it was not a re-join
+}
 
 // skips the current players turn
 type turnPassRequest struct{}
 
 // informs all players of the current player skipping their turn
 type turnPassedResponse struct {
-	Player player `json:"player"`
+	Player player `json:"player" bin:"seat"`
 }
 
 // informs all players who won the current round
 type roundWonResponse struct {
-	Player player `json:"player"`
+	Player player `json:"player" bin:"seat"`
 }
 
 // contains cards a player wishes to play for their current turn
@@ -56,23 +143,67 @@ type turnPlayRequest struct {
 
 // informs all players of the cards played for the turn
 type turnPlayedResponse struct {
-	Player player `json:"player"`
+	Player player `json:"player" bin:"seat"`
 	Cards  []card `json:"cards"`
 }
 
+// asks for suggested plays for the current turn
+type hintRequest struct{}
+
+// provides a player with suggested plays for their current turn
+type hintResponse struct {
+	Plays [][]card `json:"plays"`
+	Pass  bool     `json:"pass"` // true if there is no play that beats the last played cards
+}
+
+// asks for the best ways to group the cards in a player's hand, or if cards are
+// given, keeps the hand in that order
+type arrangeHandRequest struct {
+	Cards []int `json:"cards,omitempty"` // ... of global rank, every card in the hand once
+}
+
+// provides a player with ways to group their hand into playable combinations, best first
+type handArrangementResponse struct {
+	Partitions []handPartition `json:"partitions"`
+}
+
+// warns all players that the current turn is about to run out
+type turnTimerWarningResponse struct {
+	Player      player `json:"player" bin:"seat"`
+	SecondsLeft int    `json:"secondsLeft"`
+}
+
+// informs all players that the current player ran out of time, and so the
+// game's timeout action applies to them
+type turnTimedOutResponse struct {
+	Player player `json:"player" bin:"seat"`
+}
+
+// informs all players that a player has forfeited the game
+type playerForfeitedResponse struct {
+	Player player `json:"player" bin:"seat"`
+}
+
 // informs all players of a placed win
 type playerPlacedResponse struct {
-	Player player `json:"player"`
+	Player player `json:"player" bin:"seat"`
 	Place  int    `json:"place"`
 }
 
 // informs all players of the winner (1st place) of the game
 type gameWonResponse struct {
-	Player player `json:"player"`
+	Player player `json:"player" bin:"seat"`
+}
+
+// asks for the full game state, e.g. after a gap in the state versions. If
+// Deltas is set, later updates only hold what has changed.
+type syncStateRequest struct {
+	Deltas bool `json:"deltas"`
 }
 
 // provides all players with a full game state refresh
 type gameStateRefreshResponse struct {
+	Version    int       `json:"version"`
 	Opponents  []player  `json:"opponents"`
 	Self       player    `json:"self"`
 	SelfHand   []card    `json:"selfHand"`
@@ -80,7 +211,22 @@ type gameStateRefreshResponse struct {
 	LastPlayed []card    `json:"lastPlayed"`
 	FirstRound bool      `json:"firstRound"`
 	NewRound   bool      `json:"newRound"`
-	WinPlaces  []player  `json:"winPlaces"`
+	WinPlaces  []player  `json:"winPlaces" bin:"seat"`
+	// TurnDeadline is when the current turn runs out, if turns are timed
+	TurnDeadline *time.Time `json:"turnDeadline,omitempty"`
+	// PausedBy is the player who asked for the game to be paused, if anyone
+	PausedBy string `json:"pausedBy,omitempty"`
+	// GraceDeadlines is when the disconnect action applies to each absent player, by name
+	GraceDeadlines map[string]time.Time `json:"graceDeadlines,omitempty"`
+}
+
+// provides a player with the fields of the game state that changed since the
+// base version. Fields in Removed no longer have a value.
+type gameStateDeltaResponse struct {
+	Version     int                        `json:"version"`
+	BaseVersion int                        `json:"baseVersion"`
+	Changes     map[string]json.RawMessage `json:"changes"`
+	Removed     []string                   `json:"removed,omitempty"`
 }
 
 // requests a full game state reset
@@ -88,7 +234,7 @@ type resetGameRequest struct{}
 
 // informs all players that a reset occurred
 type gameResetResponse struct {
-	Player player `json:"player"`
+	Player player `json:"player" bin:"seat"`
 }
 
 // requests a player name change
@@ -96,6 +242,39 @@ type changeNameRequest struct {
 	PlayerName string `json:"name"`
 }
 
+// adds a bot of the given level to the lobby
+type addBotRequest struct {
+	Level botLevel `json:"level"`
+}
+
+// removes a bot from the lobby
+type removeBotRequest struct {
+	Name string `json:"name"`
+}
+
+// informs all players that a bot was removed from the lobby
+type botRemovedResponse struct {
+	Player player `json:"player" bin:"seat"`
+}
+
+// informs all players that a bot has taken over for a disconnected player
+type botTakeoverResponse struct {
+	Player player `json:"player" bin:"seat"`
+}
+
+// marks the player as ready (or not) for the next game to start
+type setReadyRequest struct {
+	Ready bool `json:"ready"`
+}
+
+// informs all players that everyone is ready and the game starts at the deadline
+type startCountdownResponse struct {
+	Deadline time.Time `json:"deadline"`
+}
+
+// informs all players that the countdown to the game starting has been stopped
+type startCancelledResponse struct{}
+
 // informs all players that a name change occurred
 type nameChangedResponse struct {
 	OldPlayer player `json:"oldPlayer"`
@@ -115,9 +294,66 @@ const (
 	errKindMustPlayLowest errorKind = 8
 	errKindInvalidName    errorKind = 9
 	errKindGameFull       errorKind = 10
+	errKindHintsDisabled  errorKind = 11
+	errKindHintCooldown   errorKind = 12
+	errKindInvalidBot     errorKind = 13
+	errKindNoPausesLeft   errorKind = 14
+	errKindIncompatible   errorKind = 15
+	errKindRateLimited    errorKind = 16
 )
 
-// informs a player of an invalid request
+// the stable code and human-readable message for each kind of error
+var errorTexts = map[errorKind]struct{ Code, Message string }{
+	errKindLobbyNotReady:  {"LOBBY_NOT_READY", "the lobby is not ready"},
+	errKindNotAuthorised:  {"NOT_AUTHORISED", "you are not allowed to do that right now"},
+	errKindOutOfTurn:      {"OUT_OF_TURN", "it is not your turn"},
+	errKindMustPlay:       {"MUST_PLAY", "you cannot pass at the start of a round"},
+	errKindInvalidCards:   {"INVALID_CARDS", "invalid cards"},
+	errKindInvalidPattern: {"INVALID_PATTERN", "invalid pattern"},
+	errKindCardsNotBetter: {"CARDS_NOT_BETTER", "cards not better than last played"},
+	errKindMustPlayLowest: {"MUST_PLAY_LOWEST", "must play lowest"},
+	errKindInvalidName:    {"INVALID_NAME", "that name is not allowed"},
+	errKindGameFull:       {"GAME_FULL", "the game is full"},
+	errKindHintsDisabled:  {"HINTS_DISABLED", "hints are disabled"},
+	errKindHintCooldown:   {"HINT_COOLDOWN", "hint requested too soon"},
+	errKindInvalidBot:     {"INVALID_BOT", "invalid bot"},
+	errKindNoPausesLeft:   {"NO_PAUSES_LEFT", "no pauses left"},
+	errKindIncompatible:   {"INCOMPATIBLE_CLIENT", "the client's protocol version is not supported"},
+	errKindRateLimited:    {"RATE_LIMITED", "too many messages, slow down"},
+}
+
+// informs a player of an invalid request. The code and message are filled in
+// from the kind when the response is sent.
 type errorResponse struct {
-	Kind errorKind `json:"kind"`
+	Kind      errorKind     `json:"kind"`
+	Details   *errorDetails `json:"details,omitempty"`
+	RequestID string        `json:"requestId,omitempty"` // ... of the request that failed, if it had one
+}
+
+// explains why a request failed, where there is more to say than the kind
+type errorDetails struct {
+	Cards           []int   `json:"cards,omitempty"`           // ... (of global rank) not in the player's hand, missing from an arrangement, or that make no pattern
+	Pattern         pattern `json:"pattern,omitempty"`         // ... of the attempted cards
+	RequiredPattern pattern `json:"requiredPattern,omitempty"` // ... of the cards to beat
+	RequiredCount   int     `json:"requiredCount,omitempty"`   // number of cards to beat
+	MustInclude     *card   `json:"mustInclude,omitempty"`
+	RetryAfterMs    int64   `json:"retryAfterMs,omitempty"`
+	// the protocol versions the server supports, if the client's is not one of them
+	MinProtocolVersion int `json:"minProtocolVersion,omitempty"`
+	MaxProtocolVersion int `json:"maxProtocolVersion,omitempty"`
+}
+
+// MarshalJSON adds the code and message for the kind of error
+func (e errorResponse) MarshalJSON() ([]byte, error) {
+	type plain errorResponse
+	return json.Marshal(struct {
+		plain
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}{plain(e), errorTexts[e.Kind].Code, errorTexts[e.Kind].Message})
+}
+
+// informs a player that their request (which had an ID) succeeded
+type ackResponse struct {
+	RequestID string `json:"requestId"`
 }
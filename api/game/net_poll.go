@@ -0,0 +1,277 @@
+package game
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ishkanan/tienlen/api/utils"
+)
+
+// The long-poll transport carries the same messages as the websocket, for
+// clients behind proxies that break websockets. A session is opened with a POST
+// without a session, which returns its ID. After that, each POST with the
+// session sends a request (one message in the body), each GET waits for
+// responses and returns those queued as a JSON array, and a DELETE closes it.
+// Sessions use the "json" or "json.v2" encoding, given by ?protocol= when opened.
+//
+// Responses are kept until acknowledged, so none are lost if a poll is cut off.
+// Each GET returns the cursor after its responses in the X-Poll-Cursor header,
+// which the next GET passes as ?ack= to drop those responses from the queue.
+
+const (
+	pollCursorHeader = "X-Poll-Cursor"
+	pollWait         = 25 * time.Second // longest a GET waits for responses
+	pollIdleTimeout  = 40 * time.Second // sessions without a GET for this long are closed
+	maxPollQueue     = 1000             // sessions with more responses waiting are closed
+)
+
+var errSinkClosed = errors.New("connection is closed")
+
+// pollSink provides an implementation of the IMessageSink interface that queues
+// responses until the client polls for them
+type pollSink struct {
+	ConnID   uuid.UUID
+	Protocol string
+	limits   *connLimiter
+	mutex    sync.Mutex
+	queue    [][]byte      // responses not yet acknowledged
+	acked    int           // cursor of the first response in the queue
+	ready    chan struct{} // signalled when responses are queued or the sink is closed
+	closed   bool
+	expiry   *time.Timer
+	dead     sync.Once
+}
+
+// Send queues a response-type message for the next poll
+func (p *pollSink) Send(response interface{}) error {
+	messageBytes, err := encodeResponse(p.Protocol, response)
+	if err != nil {
+		utils.LogDebug("Send:: Marshal error for %s - %v", p.ConnID.String(), err)
+		return err
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.closed {
+		return errSinkClosed
+	}
+	if len(p.queue) >= maxPollQueue {
+		utils.LogDebug("Send:: %s is not polling, closing it", p.ConnID.String())
+		p.closeLocked()
+		return errSinkClosed
+	}
+	p.queue = append(p.queue, messageBytes)
+	p.signal()
+	return nil
+}
+
+// Close stops the session, though responses already queued can still be polled
+func (p *pollSink) Close() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.closeLocked()
+	return nil
+}
+
+func (p *pollSink) closeLocked() {
+	p.closed = true
+	p.signal()
+}
+
+func (p *pollSink) signal() {
+	select {
+	case p.ready <- struct{}{}:
+	default:
+	}
+}
+
+// drops the responses before the cursor, which the client has received
+func (p *pollSink) acknowledge(cursor int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if cursor <= p.acked {
+		return
+	}
+	if cursor > p.acked+len(p.queue) {
+		cursor = p.acked + len(p.queue)
+	}
+	p.queue = p.queue[cursor-p.acked:]
+	p.acked = cursor
+}
+
+// waits up to the timeout for responses, returning those not yet acknowledged,
+// the cursor after them and whether the sink is closed
+func (p *pollSink) take(timeout time.Duration, cancel <-chan struct{}) ([][]byte, int, bool) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		p.mutex.Lock()
+		if len(p.queue) > 0 || p.closed {
+			queue := append([][]byte(nil), p.queue...)
+			cursor, closed := p.acked+len(queue), p.closed && len(queue) == 0
+			p.mutex.Unlock()
+			return queue, cursor, closed
+		}
+		cursor := p.acked
+		p.mutex.Unlock()
+
+		select {
+		case <-p.ready:
+		case <-timer.C:
+			return nil, cursor, false
+		case <-cancel:
+			return nil, cursor, false
+		}
+	}
+}
+
+// PollHandler serves the long-poll transport, feeding requests to the game in
+// the same way as ConnectionHandler
+func PollHandler(game IMessageSource, limiter *Limiter) func(w http.ResponseWriter, r *http.Request) {
+	sessions := map[string]*pollSink{}
+	mutex := sync.Mutex{}
+
+	// tells the game the session has gone, once
+	endSession := func(sessionID string, sink *pollSink) {
+		sink.dead.Do(func() {
+			mutex.Lock()
+			delete(sessions, sessionID)
+			mutex.Unlock()
+			_ = sink.Close()
+			sink.expiry.Stop()
+			game.ConnectionStateChanged(sink.ConnID, sink, connStateDead)
+		})
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !originAllowed(r) {
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		sessionID := r.URL.Query().Get("session")
+
+		if sessionID == "" && r.Method == http.MethodPost {
+			protocol := r.URL.Query().Get("protocol")
+			if protocol == "" {
+				protocol = protocolJSON
+			}
+			if protocol != protocolJSON && protocol != protocolJSONv2 {
+				http.Error(w, "unsupported protocol", http.StatusBadRequest)
+				return
+			}
+
+			connID := uuid.New()
+			sink := &pollSink{ConnID: connID, Protocol: protocol, limits: limiter.forConnection(r), ready: make(chan struct{}, 1)}
+			if !game.IsAcceptingConnections() {
+				messageBytes, _ := encodeResponse(protocol, errorResponse{Kind: errKindGameFull})
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				_, _ = w.Write(messageBytes)
+				utils.LogDebug("PollHandler:: %s tried to join, but game is full", r.RemoteAddr)
+				return
+			}
+
+			sessionID = uuid.New().String()
+			sink.expiry = time.AfterFunc(pollIdleTimeout, func() {
+				utils.LogDebug("PollHandler:: %s stopped polling", connID.String())
+				endSession(sessionID, sink)
+			})
+			mutex.Lock()
+			sessions[sessionID] = sink
+			mutex.Unlock()
+			utils.LogDebug("PollHandler:: %s is assigned connID %s", r.RemoteAddr, connID.String())
+
+			game.ConnectionStateChanged(connID, sink, connStateNew)
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(struct {
+				Session string `json:"session"`
+			}{sessionID})
+			return
+		}
+
+		mutex.Lock()
+		sink := sessions[sessionID]
+		mutex.Unlock()
+		if sink == nil {
+			http.Error(w, "unknown session", http.StatusNotFound)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPost:
+			messageBytes, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, limiter.limits.MaxMessageSize))
+			if err != nil {
+				limiter.countOversized()
+				http.Error(w, "request too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+
+			// decoded before the limits are checked, so a refusal can carry the
+			// request ID, though messages that fail to decode still count
+			request, requestID, err := decodeRequest(sink.Protocol, messageBytes)
+			verdict, wait := sink.limits.check(time.Now())
+			if verdict != verdictAllow {
+				w.Header().Set("Retry-After", retryAfter(wait))
+				if verdict == verdictDisconnect {
+					utils.LogInfo("PollHandler:: %s is flooding, disconnecting it", sink.ConnID.String())
+					endSession(sessionID, sink)
+				}
+				if verdict == verdictDrop {
+					w.WriteHeader(http.StatusTooManyRequests)
+					return
+				}
+				messageBytes, _ := encodeResponse(sink.Protocol, rateLimitedError(wait, requestID))
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusTooManyRequests)
+				_, _ = w.Write(messageBytes)
+				return
+			}
+
+			if err != nil {
+				utils.LogDebug("PollHandler:: decode error for %s - %v", sink.ConnID.String(), err)
+				http.Error(w, "invalid message", http.StatusBadRequest)
+				return
+			}
+			game.ProcessRequest(sink.ConnID, requestID, request, reflect.TypeOf(request))
+			w.WriteHeader(http.StatusNoContent)
+
+		case http.MethodGet:
+			sink.expiry.Reset(pollIdleTimeout)
+			if ack := r.URL.Query().Get("ack"); ack != "" {
+				cursor, err := strconv.Atoi(ack)
+				if err != nil {
+					http.Error(w, "invalid ack", http.StatusBadRequest)
+					return
+				}
+				sink.acknowledge(cursor)
+			}
+			messages, cursor, closed := sink.take(pollWait, r.Context().Done())
+			if closed {
+				endSession(sessionID, sink)
+				http.Error(w, "session closed", http.StatusGone)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set(pollCursorHeader, strconv.Itoa(cursor))
+			_, _ = w.Write(append(append([]byte("["), bytes.Join(messages, []byte(","))...), ']'))
+
+		case http.MethodDelete:
+			endSession(sessionID, sink)
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
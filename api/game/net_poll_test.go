@@ -0,0 +1,72 @@
+package game
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPollTransport(t *testing.T) {
+	g := NewGame(DefaultRules())
+	server := httptest.NewServer(http.HandlerFunc(PollHandler(g, NewLimiter(DefaultLimits()))))
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"?protocol=json.v2", "application/json", nil)
+	assert.Nil(t, err)
+	opened := struct{ Session string }{}
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(&opened))
+	resp.Body.Close()
+	assert.NotEmpty(t, opened.Session)
+	url := server.URL + "?session=" + opened.Session
+
+	resp, err = http.Post(url, "application/json", strings.NewReader(`{"kind":"JOIN_GAME","id":"1","data":{"playerName":"Al"}}`))
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	// polls for the kinds of the queued responses, and the cursor after them
+	poll := func(query string) ([]string, string) {
+		resp, err := http.Get(url + query)
+		assert.Nil(t, err)
+		defer resp.Body.Close()
+		messages := []MessageV2{}
+		assert.Nil(t, json.NewDecoder(resp.Body).Decode(&messages))
+		kinds := []string{}
+		for _, message := range messages {
+			kinds = append(kinds, message.Kind)
+		}
+		return kinds, resp.Header.Get(pollCursorHeader)
+	}
+
+	// the responses queued since the last poll are returned together
+	kinds, cursor := poll("")
+	assert.Equal(t, []string{"PLAYER_JOINED", "GAME_STATE_REFRESH", "ACK"}, kinds)
+	assert.Equal(t, "3", cursor)
+
+	// ... and again until acknowledged, in case the poll did not arrive
+	kinds, _ = poll("")
+	assert.Equal(t, []string{"PLAYER_JOINED", "GAME_STATE_REFRESH", "ACK"}, kinds)
+	resp, err = http.Post(url, "application/json", strings.NewReader(`{"kind":"SYNC_STATE","id":"2","data":{}}`))
+	assert.Nil(t, err)
+	resp.Body.Close()
+	kinds, cursor = poll("&ack=" + cursor)
+	assert.Equal(t, []string{"GAME_STATE_REFRESH", "ACK"}, kinds)
+	assert.Equal(t, "5", cursor)
+
+	// closing the session disconnects the player
+	req, _ := http.NewRequest(http.MethodDelete, url, nil)
+	resp, err = http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	withLock(g, func() {
+		assert.Empty(t, g.players)
+	})
+	resp, err = http.Get(url)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
@@ -5,7 +5,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -14,16 +18,87 @@ import (
 	"github.com/ishkanan/tienlen/api/utils"
 )
 
+const (
+	protocolJSON   = "json"    // message data is base64-encoded JSON
+	protocolJSONv2 = "json.v2" // message data is embedded JSON
+	protocolBinary = "binary"  // messages are compact binary, see binary.go
+)
+
+const (
+	protocolVersion    = 1 // increases with changes to the messages that clients must know about
+	minProtocolVersion = 1 // the oldest protocol version clients may still use
+)
+
+// the optional parts of the protocol, which the server lists in its HELLO if
+// they are enabled. Clients may ask for stateDeltas in theirs.
+const (
+	featureRequestIDs  = "requestIds"  // requests with IDs are acknowledged
+	featureStateDeltas = "stateDeltas" // state updates may be sent as deltas, see SYNC_STATE
+	featureEventReplay = "eventReplay" // missed events are re-sent on re-joining
+	featureHints       = "hints"
+	featureTurnClock   = "turnClock" // moves are timed
+)
+
+const (
+	pingInterval = 10 * time.Second // time between pings
+	pongWait     = 25 * time.Second // time without a pong after which the peer is dead
+	writeWait    = 5 * time.Second  // time a write may take before the peer is dead
+)
+
 var upgrader = websocket.Upgrader{
-	CheckOrigin:  func(r *http.Request) bool { return true },
-	Subprotocols: []string{"json"},
+	CheckOrigin:  originAllowed,
+	Subprotocols: []string{protocolJSONv2, protocolBinary, protocolJSON},
+}
+
+// the origins of other sites allowed to connect, any if there are none
+var allowedOrigins []string
+
+// SetAllowedOrigins limits the web pages that may connect to those served by
+// this server and the given origins, e.g. "https://example.com". An origin may
+// start with a wildcard for any subdomain, e.g. "https://*.example.com".
+// Spaces around each origin are ignored, as are empty origins.
+func SetAllowedOrigins(origins []string) {
+	allowedOrigins = nil
+	for _, origin := range origins {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			allowedOrigins = append(allowedOrigins, origin)
+		}
+	}
+}
+
+// returns true if the request comes from an allowed origin. Requests without
+// an Origin header do not come from browsers, so are allowed.
+func originAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || len(allowedOrigins) == 0 {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	for _, allowed := range allowedOrigins {
+		if strings.EqualFold(allowed, origin) {
+			return true
+		}
+		parts := strings.SplitN(allowed, "://*.", 2)
+		if len(parts) == 2 && strings.EqualFold(parts[0], u.Scheme) && strings.HasSuffix(strings.ToLower(u.Host), "."+strings.ToLower(parts[1])) {
+			return true
+		}
+	}
+	return false
 }
 
 // IMessageSource defines how the ingress socket events are pumped to the game
 type IMessageSource interface {
 	IsAcceptingConnections() bool
 	ConnectionStateChanged(uuid.UUID, IMessageSink, connState)
-	ProcessRequest(uuid.UUID, interface{}, reflect.Type)
+	ProcessRequest(uuid.UUID, string, interface{}, reflect.Type)
+	LatencyMeasured(uuid.UUID, time.Duration)
 }
 
 // IMessageSink defines how the game interfaces with the underlying sockets
@@ -36,86 +111,266 @@ type IMessageSink interface {
 type MessageSink struct {
 	ConnID     uuid.UUID
 	Connection *websocket.Conn
+	Protocol   string // the negotiated subprotocol, which decides the message encoding
+	queue      *outboundQueue
 }
 
-// Send attempts to send a response-type message through the underlying connection
+// NewMessageSink builds a sink for the connection, whose messages are written
+// in the background
+func NewMessageSink(connID uuid.UUID, conn *websocket.Conn) MessageSink {
+	m := MessageSink{ConnID: connID, Connection: conn, Protocol: conn.Subprotocol()}
+	m.queue = newOutboundQueue(connID, m.write, conn.Close)
+	return m
+}
+
+// Send queues a response-type message to be sent through the underlying
+// connection. Events are sent with their sequence.
 func (m MessageSink) Send(response interface{}) error {
+	messageBytes, err := encodeResponse(m.Protocol, response)
+	if err != nil {
+		utils.LogDebug("Send:: Marshal error for %s - %v", m.ConnID.String(), err)
+		return err
+	}
+	return m.queue.push(messageBytes)
+}
+
+// writes an encoded message to the connection
+func (m MessageSink) write(messageBytes []byte) error {
+	_ = m.Connection.SetWriteDeadline(time.Now().Add(writeWait))
+	if m.Protocol == protocolBinary {
+		return m.Connection.WriteMessage(websocket.BinaryMessage, messageBytes)
+	}
+	return m.Connection.WriteMessage(websocket.TextMessage, messageBytes)
+}
+
+// encodes a response-type message (or event) for the subprotocol
+func encodeResponse(protocol string, response interface{}) ([]byte, error) {
+	seq := 0
+	if event, ok := response.(sequencedEvent); ok {
+		seq, response = event.Seq, event.Response
+	}
+
+	if protocol == protocolBinary {
+		return encodeBinary(responseKinds(), "", seq, response)
+	}
+
 	responseType := reflect.TypeOf(response)
 	for t, ident := range responseMap() {
 		if t == responseType {
 			responseBytes, err := json.Marshal(response)
 			if err != nil {
-				utils.LogDebug("Send:: Marshal error for %s - %v", m.ConnID.String(), err)
-				return err
+				return nil, err
 			}
-			return m.Connection.WriteJSON(Message{
-				Kind: ident,
-				Data: base64.StdEncoding.EncodeToString(responseBytes),
-			})
+			return encodeMessage(protocol, ident, seq, responseBytes)
 		}
 	}
-	return fmt.Errorf("unrecognised response type (%s)", responseType.Name())
+	return nil, fmt.Errorf("unrecognised response type (%s)", responseType.Name())
+}
+
+// wraps the JSON data of a message in the envelope for the subprotocol
+func encodeMessage(protocol, kind string, seq int, data []byte) ([]byte, error) {
+	if protocol == protocolJSONv2 {
+		return json.Marshal(MessageV2{Kind: kind, Seq: seq, Data: data})
+	}
+	return json.Marshal(Message{Kind: kind, Seq: seq, Data: base64.StdEncoding.EncodeToString(data)})
+}
+
+// unwraps a message in the envelope for the subprotocol, returning its kind, ID
+// and JSON data
+func decodeMessage(protocol string, messageBytes []byte) (string, string, []byte, error) {
+	if protocol == protocolJSONv2 {
+		message := MessageV2{}
+		if err := json.Unmarshal(messageBytes, &message); err != nil {
+			return "", "", nil, err
+		}
+		if len(message.Data) == 0 {
+			// requests without fields may leave out their data
+			return message.Kind, message.ID, []byte("{}"), nil
+		}
+		return message.Kind, message.ID, message.Data, nil
+	}
+
+	message := Message{}
+	if err := json.Unmarshal(messageBytes, &message); err != nil {
+		return "", "", nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(message.Data)
+	return message.Kind, message.ID, data, err
 }
 
-// Close closes the underlying connection
+// decodes a request in the encoding for the subprotocol, returning it along
+// with its ID
+func decodeRequest(protocol string, messageBytes []byte) (interface{}, string, error) {
+	if protocol == protocolBinary {
+		request, requestID, _, err := decodeBinary(requestKinds(), messageBytes)
+		return request, requestID, err
+	}
+	kind, requestID, requestBytes, err := decodeMessage(protocol, messageBytes)
+	if err != nil {
+		return nil, "", err
+	}
+	request, err := buildRequest(kind, requestBytes)
+	return request, requestID, err
+}
+
+// pings the peer until stopped, recording each ping so the round-trip time can
+// be measured from the pong. The connection is closed if a ping cannot be
+// written, which ends the read loop.
+func heartbeat(conn *websocket.Conn, connID uuid.UUID, pings *pingTracker, stop <-chan struct{}) {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for {
+		now := time.Now()
+		err := conn.WriteControl(websocket.PingMessage, pings.ping(now), now.Add(writeWait))
+		if err != nil {
+			utils.LogDebug("heartbeat:: ping write error for %s - %v", connID.String(), err)
+			_ = conn.Close()
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// remembers when each ping was sent, so round-trip times are measured by the
+// server alone rather than from times the peer could make up
+type pingTracker struct {
+	mutex sync.Mutex
+	count int
+	sent  map[string]time.Time // by payload
+}
+
+func newPingTracker() *pingTracker {
+	return &pingTracker{sent: map[string]time.Time{}}
+}
+
+// records a ping sent at the given time, returning its payload
+func (p *pingTracker) ping(now time.Time) []byte {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for payload, sentAt := range p.sent {
+		// the peer is dead if it has not answered by now
+		if now.Sub(sentAt) > pongWait {
+			delete(p.sent, payload)
+		}
+	}
+	p.count++
+	payload := strconv.Itoa(p.count)
+	p.sent[payload] = now
+	return []byte(payload)
+}
+
+// returns the round-trip time of the ping answered by a pong received at the
+// given time, or false if the pong does not answer a ping that is outstanding
+func (p *pingTracker) pong(payload string, now time.Time) (time.Duration, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	sentAt, ok := p.sent[payload]
+	if !ok {
+		return 0, false
+	}
+	delete(p.sent, payload)
+	return now.Sub(sentAt), true
+}
+
+// Close closes the underlying connection once the queued messages are sent
 func (m MessageSink) Close() error {
-	return m.Connection.Close()
+	m.queue.close()
+	return nil
+}
+
+// a kind of message and the Golang type that carries it
+type messageKind struct {
+	Ident string
+	Type  reflect.Type
+}
+
+// lists the request (ingress message) kinds. The binary subprotocol identifies
+// kinds by their position, so new kinds must be added to the end.
+func requestKinds() []messageKind {
+	return []messageKind{
+		{"JOIN_GAME", reflect.TypeOf(joinGameRequest{})},
+		{"START_GAME", reflect.TypeOf(startGameRequest{})},
+		{"RESET_GAME", reflect.TypeOf(resetGameRequest{})},
+		{"TURN_PASS", reflect.TypeOf(turnPassRequest{})},
+		{"TURN_PLAY", reflect.TypeOf(turnPlayRequest{})},
+		{"CHANGE_NAME", reflect.TypeOf(changeNameRequest{})},
+		{"HINT", reflect.TypeOf(hintRequest{})},
+		{"SYNC_STATE", reflect.TypeOf(syncStateRequest{})},
+		{"ARRANGE_HAND", reflect.TypeOf(arrangeHandRequest{})},
+		{"ADD_BOT", reflect.TypeOf(addBotRequest{})},
+		{"REMOVE_BOT", reflect.TypeOf(removeBotRequest{})},
+		{"LEAVE_GAME", reflect.TypeOf(leaveGameRequest{})},
+		{"PAUSE_GAME", reflect.TypeOf(pauseGameRequest{})},
+		{"RESUME_GAME", reflect.TypeOf(resumeGameRequest{})},
+		{"SET_READY", reflect.TypeOf(setReadyRequest{})},
+		{"HELLO", reflect.TypeOf(helloRequest{})},
+	}
+}
+
+// lists the response (egress message) kinds. The binary subprotocol identifies
+// kinds by their position, so new kinds must be added to the end.
+func responseKinds() []messageKind {
+	return []messageKind{
+		{"PLAYER_JOINED", reflect.TypeOf(playerJoinedResponse{})},
+		{"PLAYER_DISCONNECTED", reflect.TypeOf(playerDisconnectedResponse{})},
+		{"GAME_STARTED", reflect.TypeOf(gameStartedResponse{})},
+		{"GAME_PAUSED", reflect.TypeOf(gamePausedResponse{})},
+		{"GAME_ABANDONED", reflect.TypeOf(gameAbandonedResponse{})},
+		{"PLAYER_LEFT", reflect.TypeOf(playerLeftResponse{})},
+		{"START_COUNTDOWN", reflect.TypeOf(startCountdownResponse{})},
+		{"START_CANCELLED", reflect.TypeOf(startCancelledResponse{})},
+		{"GAME_RESUMED", reflect.TypeOf(gameResumedResponse{})},
+		{"GAME_RESET", reflect.TypeOf(gameResetResponse{})},
+		{"TURN_PASSED", reflect.TypeOf(turnPassedResponse{})},
+		{"ROUND_WON", reflect.TypeOf(roundWonResponse{})},
+		{"TURN_PLAYED", reflect.TypeOf(turnPlayedResponse{})},
+		{"NAME_CHANGED", reflect.TypeOf(nameChangedResponse{})},
+		{"PLAYER_PLACED", reflect.TypeOf(playerPlacedResponse{})},
+		{"GAME_WON", reflect.TypeOf(gameWonResponse{})},
+		{"GAME_STATE_REFRESH", reflect.TypeOf(gameStateRefreshResponse{})},
+		{"GAME_STATE_DELTA", reflect.TypeOf(gameStateDeltaResponse{})},
+		{"HINT", reflect.TypeOf(hintResponse{})},
+		{"BOT_REMOVED", reflect.TypeOf(botRemovedResponse{})},
+		{"BOT_TAKEOVER", reflect.TypeOf(botTakeoverResponse{})},
+		{"HAND_ARRANGEMENT", reflect.TypeOf(handArrangementResponse{})},
+		{"TURN_TIMER_WARNING", reflect.TypeOf(turnTimerWarningResponse{})},
+		{"TURN_TIMED_OUT", reflect.TypeOf(turnTimedOutResponse{})},
+		{"PLAYER_FORFEITED", reflect.TypeOf(playerForfeitedResponse{})},
+		{"ERROR", reflect.TypeOf(errorResponse{})},
+		{"ACK", reflect.TypeOf(ackResponse{})},
+		{"EVENTS_REPLAYED", reflect.TypeOf(eventsReplayedResponse{})},
+		{"HELLO", reflect.TypeOf(helloResponse{})},
+	}
 }
 
 // builds a request (ingress message) object based on the identifier
 func buildRequest(ident string, data []byte) (interface{}, error) {
-	switch ident {
-	case "JOIN_GAME":
-		request := joinGameRequest{}
-		err := json.Unmarshal(data, &request)
-		return request, err
-	case "START_GAME":
-		request := startGameRequest{}
-		err := json.Unmarshal(data, &request)
-		return request, err
-	case "RESET_GAME":
-		request := resetGameRequest{}
-		err := json.Unmarshal(data, &request)
-		return request, err
-	case "TURN_PASS":
-		request := turnPassRequest{}
-		err := json.Unmarshal(data, &request)
-		return request, err
-	case "TURN_PLAY":
-		request := turnPlayRequest{}
-		err := json.Unmarshal(data, &request)
-		return request, err
-	case "CHANGE_NAME":
-		request := changeNameRequest{}
-		err := json.Unmarshal(data, &request)
-		return request, err
-	default:
-		return nil, fmt.Errorf("unrecognised request type (%s)", ident)
+	for _, kind := range requestKinds() {
+		if kind.Ident == ident {
+			request := reflect.New(kind.Type)
+			err := json.Unmarshal(data, request.Interface())
+			return request.Elem().Interface(), err
+		}
 	}
+	return nil, fmt.Errorf("unrecognised request type (%s)", ident)
 }
 
 // maps response (egress messages) Golang types to identifiers
 func responseMap() map[reflect.Type]string {
-	return map[reflect.Type]string{
-		reflect.TypeOf(playerJoinedResponse{}):       "PLAYER_JOINED",
-		reflect.TypeOf(playerDisconnectedResponse{}): "PLAYER_DISCONNECTED",
-		reflect.TypeOf(gameStartedResponse{}):        "GAME_STARTED",
-		reflect.TypeOf(gamePausedResponse{}):         "GAME_PAUSED",
-		reflect.TypeOf(gameResumedResponse{}):        "GAME_RESUMED",
-		reflect.TypeOf(gameResetResponse{}):          "GAME_RESET",
-		reflect.TypeOf(turnPassedResponse{}):         "TURN_PASSED",
-		reflect.TypeOf(roundWonResponse{}):           "ROUND_WON",
-		reflect.TypeOf(turnPlayedResponse{}):         "TURN_PLAYED",
-		reflect.TypeOf(nameChangedResponse{}):        "NAME_CHANGED",
-		reflect.TypeOf(playerPlacedResponse{}):       "PLAYER_PLACED",
-		reflect.TypeOf(gameWonResponse{}):            "GAME_WON",
-		reflect.TypeOf(gameStateRefreshResponse{}):   "GAME_STATE_REFRESH",
-		reflect.TypeOf(errorResponse{}):              "ERROR",
+	identifiers := map[reflect.Type]string{}
+	for _, kind := range responseKinds() {
+		identifiers[kind.Type] = kind.Ident
 	}
+	return identifiers
 }
 
 // ConnectionHandler provides incoming message and ping "pump" logic for a given connection
-func ConnectionHandler(game IMessageSource) func(w http.ResponseWriter, r *http.Request) {
+func ConnectionHandler(game IMessageSource, limiter *Limiter) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		utils.LogDebug("ConnectionHandler:: New HTTP connection from %s", r.RemoteAddr)
 
@@ -125,10 +380,17 @@ func ConnectionHandler(game IMessageSource) func(w http.ResponseWriter, r *http.
 			return
 		}
 		defer conn.Close()
+		conn.SetReadLimit(limiter.limits.MaxMessageSize)
+		limits := limiter.forConnection(r)
 
 		connID := uuid.New()
 		utils.LogDebug("ConnectionHandler:: %s is assigned connID %s", r.RemoteAddr, connID.String())
-		sink := MessageSink{ConnID: connID, Connection: conn}
+		sink := NewMessageSink(connID, conn)
+		defer func() {
+			_ = sink.Close()
+			sink.queue.wait()
+		}()
+		utils.LogDebug("ConnectionHandler:: %s is using subprotocol %q", connID.String(), sink.Protocol)
 
 		if !game.IsAcceptingConnections() {
 			_ = sink.Send(errorResponse{Kind: errKindGameFull})
@@ -138,47 +400,52 @@ func ConnectionHandler(game IMessageSource) func(w http.ResponseWriter, r *http.
 
 		game.ConnectionStateChanged(connID, sink, connStateNew)
 
-		var lastPingError error
+		// a peer that stops answering pings is dead once the read deadline passes
+		_ = conn.SetReadDeadline(time.Now().Add(pongWait))
+		pings := newPingTracker()
 		conn.SetPongHandler(func(appData string) error {
-			go func() {
-				// sends one final ping after connection death, which is fine
-				time.Sleep(5 * time.Second)
-				lastPingError = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(5*time.Second))
-			}()
-			if lastPingError != nil {
-				utils.LogDebug("ConnectionHandler:: ping write error for %s - %v", connID.String(), err)
+			_ = conn.SetReadDeadline(time.Now().Add(pongWait))
+			if latency, ok := pings.pong(appData, time.Now()); ok {
+				game.LatencyMeasured(connID, latency)
 			}
-			return lastPingError
+			return nil
 		})
-		err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(5*time.Second))
-		if err != nil {
-			utils.LogDebug("ConnectionHandler:: initial ping write error for %s - %v", connID.String(), err)
-			game.ConnectionStateChanged(connID, sink, connStateDead)
-			return
-		}
+		stopHeartbeat := make(chan struct{})
+		defer close(stopHeartbeat)
+		go heartbeat(conn, connID, pings, stopHeartbeat)
 
-		var message Message
 		for {
-			err = conn.ReadJSON(&message)
+			_, messageBytes, err := conn.ReadMessage()
 			if err != nil {
+				if err == websocket.ErrReadLimit {
+					limiter.countOversized()
+				}
 				utils.LogDebug("ConnectionHandler:: read error for %s - %v", connID.String(), err)
 				game.ConnectionStateChanged(connID, sink, connStateDead)
 				return
 			}
 
-			requestBytes, err := base64.StdEncoding.DecodeString(message.Data)
-			if err != nil {
-				utils.LogDebug("ConnectionHandler:: decode error for %s - %v", connID.String(), err)
+			// decoded before the limits are checked, so a refusal can carry the
+			// request ID, though messages that fail to decode still count
+			request, requestID, err := decodeRequest(sink.Protocol, messageBytes)
+			switch verdict, wait := limits.check(time.Now()); verdict {
+			case verdictDrop:
 				continue
+			case verdictReject:
+				_ = sink.Send(rateLimitedError(wait, requestID))
+				continue
+			case verdictDisconnect:
+				utils.LogInfo("ConnectionHandler:: %s is flooding, disconnecting it", connID.String())
+				_ = sink.Send(rateLimitedError(wait, requestID))
+				game.ConnectionStateChanged(connID, sink, connStateDead)
+				return
 			}
-
-			request, err := buildRequest(message.Kind, requestBytes)
 			if err != nil {
-				utils.LogDebug("ConnectionHandler:: marshal error for %s - %v", connID.String(), err)
+				utils.LogDebug("ConnectionHandler:: decode error for %s - %v", connID.String(), err)
 				continue
 			}
 
-			game.ProcessRequest(connID, request, reflect.TypeOf(request))
+			game.ProcessRequest(connID, requestID, request, reflect.TypeOf(request))
 		}
 	}
 }
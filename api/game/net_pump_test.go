@@ -0,0 +1,132 @@
+package game
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageEncoding(t *testing.T) {
+	data := []byte(`{"cards":[52,51]}`)
+
+	encoded, err := encodeMessage(protocolJSON, "TURN_PLAY", 0, data)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"kind":"TURN_PLAY","data":"eyJjYXJkcyI6WzUyLDUxXX0="}`, string(encoded))
+	kind, _, decoded, err := decodeMessage(protocolJSON, encoded)
+	assert.Nil(t, err)
+	assert.Equal(t, "TURN_PLAY", kind)
+	assert.Equal(t, data, decoded)
+
+	encoded, err = encodeMessage(protocolJSONv2, "TURN_PLAY", 7, data)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"kind":"TURN_PLAY","seq":7,"data":{"cards":[52,51]}}`, string(encoded))
+	kind, _, decoded, err = decodeMessage(protocolJSONv2, encoded)
+	assert.Nil(t, err)
+	assert.Equal(t, "TURN_PLAY", kind)
+	assert.Equal(t, data, decoded)
+
+	// v2 requests without fields may leave out their data
+	kind, _, decoded, err = decodeMessage(protocolJSONv2, []byte(`{"kind":"START_GAME"}`))
+	assert.Nil(t, err)
+	request, err := buildRequest(kind, decoded)
+	assert.Nil(t, err)
+	assert.Equal(t, startGameRequest{}, request)
+}
+
+func TestErrorResponseJSON(t *testing.T) {
+	response := errorResponse{
+		Kind:    errKindCardsNotBetter,
+		Details: &errorDetails{Pattern: patternSingle, RequiredPattern: patternDouble, RequiredCount: 2},
+	}
+	data, err := json.Marshal(response)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{
+		"kind": 7,
+		"code": "CARDS_NOT_BETTER",
+		"message": "cards not better than last played",
+		"details": {"pattern": 1, "requiredPattern": 2, "requiredCount": 2}
+	}`, string(data))
+}
+
+func TestAllowedOrigins(t *testing.T) {
+	defer SetAllowedOrigins(nil)
+	request := func(origin string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "http://tienlen.example.com/api", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		return r
+	}
+
+	assert.True(t, originAllowed(request("https://elsewhere.com")))
+
+	SetAllowedOrigins([]string{"https://friend.com", "https://*.example.org"})
+	assert.True(t, originAllowed(request("")))
+	assert.True(t, originAllowed(request("http://tienlen.example.com")))
+	assert.True(t, originAllowed(request("https://friend.com")))
+	assert.True(t, originAllowed(request("https://tv.example.org")))
+	assert.False(t, originAllowed(request("https://elsewhere.com")))
+	assert.False(t, originAllowed(request("http://tv.example.org")))
+	assert.False(t, originAllowed(request("https://example.org.evil.com")))
+
+	// as given on the command line, with spaces after the commas
+	SetAllowedOrigins(strings.Split("https://friend.com, https://pal.com,", ","))
+	assert.True(t, originAllowed(request("https://friend.com")))
+	assert.True(t, originAllowed(request("https://pal.com")))
+	assert.False(t, originAllowed(request("https://elsewhere.com")))
+}
+
+func TestHeartbeatLatency(t *testing.T) {
+	g := NewGame(DefaultRules())
+	server := httptest.NewServer(http.HandlerFunc(ConnectionHandler(g, NewLimiter(DefaultLimits()))))
+	defer server.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{protocolJSONv2}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	assert.Nil(t, err)
+	defer conn.Close()
+	assert.Nil(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"kind":"JOIN_GAME","data":{"playerName":"Al"}}`)))
+	go func() {
+		// reading answers the pings
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	assert.Eventually(t, func() bool {
+		latency := int64(0)
+		withLock(g, func() {
+			if len(g.players) > 0 {
+				latency = g.players[0].LatencyMs
+			}
+		})
+		return latency > 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestPingTracker(t *testing.T) {
+	pings := newPingTracker()
+	now := time.Now()
+	payload := pings.ping(now)
+
+	// pongs that do not answer a ping sent by the server are not measured
+	_, ok := pings.pong(strconv.FormatInt(now.Add(-time.Hour).UnixNano(), 10), now)
+	assert.False(t, ok)
+
+	latency, ok := pings.pong(string(payload), now.Add(30*time.Millisecond))
+	assert.True(t, ok)
+	assert.Equal(t, 30*time.Millisecond, latency)
+
+	// ... and each ping is only answered once
+	_, ok = pings.pong(string(payload), now.Add(time.Second))
+	assert.False(t, ok)
+}
@@ -0,0 +1,105 @@
+package game
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+
+	"github.com/ishkanan/tienlen/api/utils"
+)
+
+const outboundQueueSize = 256 // messages waiting to be written, beyond which a client is too slow
+
+// outboundQueue writes the encoded messages for a connection on its own
+// goroutine, so the game never waits on the network while holding its lock
+type outboundQueue struct {
+	connID    uuid.UUID
+	messages  chan []byte
+	mutex     sync.Mutex
+	closed    bool // no more messages are accepted
+	dropped   bool // the client fell behind, so the queued messages are not written
+	closeConn func() error
+	closeOnce sync.Once
+	done      chan struct{} // closed once the writer has stopped
+}
+
+// starts a queue that writes messages with write, and calls closeConn once
+// it has stopped, either when closed or when a write fails. closeConn is also
+// called straight away if the client falls behind, and must not block.
+func newOutboundQueue(connID uuid.UUID, write func([]byte) error, closeConn func() error) *outboundQueue {
+	q := &outboundQueue{
+		connID:    connID,
+		messages:  make(chan []byte, outboundQueueSize),
+		closeConn: closeConn,
+		done:      make(chan struct{}),
+	}
+	go func() {
+		defer close(q.done)
+		for message := range q.messages {
+			if q.isDropped() {
+				break
+			}
+			if err := write(message); err != nil {
+				utils.LogDebug("outboundQueue:: write error for %s - %v", connID.String(), err)
+				break
+			}
+		}
+		q.disconnect()
+	}()
+	return q
+}
+
+// queues a message to be written. A client whose queue is full is not keeping
+// up, so its connection is closed at once and the queued messages are dropped.
+// Closing the connection fails its reads too, which tells the game it is gone.
+func (q *outboundQueue) push(message []byte) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.closed {
+		return errSinkClosed
+	}
+
+	select {
+	case q.messages <- message:
+		return nil
+	default:
+		utils.LogInfo("outboundQueue:: %s is too slow, disconnecting it", q.connID.String())
+		q.dropped = true
+		q.closeLocked()
+		q.disconnect()
+		return errSinkClosed
+	}
+}
+
+// stops accepting messages, closing the connection once those already queued
+// have been written
+func (q *outboundQueue) close() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.closeLocked()
+}
+
+func (q *outboundQueue) closeLocked() {
+	if !q.closed {
+		q.closed = true
+		close(q.messages)
+	}
+}
+
+func (q *outboundQueue) isDropped() bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.dropped
+}
+
+// closes the connection, once only
+func (q *outboundQueue) disconnect() {
+	q.closeOnce.Do(func() {
+		_ = q.closeConn()
+	})
+}
+
+// waits for the writer to stop
+func (q *outboundQueue) wait() {
+	<-q.done
+}
@@ -0,0 +1,67 @@
+package game
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutboundQueueDrains(t *testing.T) {
+	written := []string{}
+	closed := false
+	q := newOutboundQueue(uuid.New(), func(message []byte) error {
+		written = append(written, string(message))
+		return nil
+	}, func() error {
+		closed = true
+		return nil
+	})
+
+	assert.Nil(t, q.push([]byte("a")))
+	assert.Nil(t, q.push([]byte("b")))
+	q.close()
+	q.wait()
+
+	// the queued messages are written in order before the connection is closed
+	assert.Equal(t, []string{"a", "b"}, written)
+	assert.True(t, closed)
+	assert.Equal(t, errSinkClosed, q.push([]byte("c")))
+}
+
+func TestOutboundQueueSlowConsumer(t *testing.T) {
+	// the write stalls until the connection is closed, as for a client that
+	// has stopped reading
+	disconnected := make(chan struct{})
+	writing := make(chan struct{}, outboundQueueSize)
+	q := newOutboundQueue(uuid.New(), func(message []byte) error {
+		writing <- struct{}{}
+		<-disconnected
+		return errors.New("use of closed network connection")
+	}, func() error {
+		close(disconnected)
+		return nil
+	})
+
+	// once its queue is full, the client is disconnected without waiting for
+	// the stalled write, and the sender is never held up
+	assert.Nil(t, q.push([]byte("state")))
+	<-writing
+	var err error
+	for i := 0; i <= outboundQueueSize+1 && err == nil; i++ {
+		err = q.push([]byte("state"))
+	}
+	assert.Equal(t, errSinkClosed, err)
+	select {
+	case <-disconnected:
+	case <-time.After(time.Second):
+		t.Fatal("slow client was not disconnected")
+	}
+
+	// the backlog is dropped rather than written
+	q.wait()
+	assert.Equal(t, 0, len(writing))
+	assert.Equal(t, errSinkClosed, q.push([]byte("state")))
+}
@@ -0,0 +1,123 @@
+package game
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ishkanan/tienlen/api/utils"
+)
+
+const sseKeepAlive = 15 * time.Second // ... comments stop proxies closing idle streams
+
+// sseSink provides an implementation of the IMessageSink interface that streams
+// messages to a read-only observer as Server-Sent Events. Each event is named
+// after the message kind and its data is the message as JSON.
+type sseSink struct {
+	ConnID uuid.UUID
+	queue  *outboundQueue
+	done   chan struct{} // closed when the stream should end
+}
+
+// Send writes a response-type message to the stream
+func (s *sseSink) Send(response interface{}) error {
+	seq := 0
+	if event, ok := response.(sequencedEvent); ok {
+		seq, response = event.Seq, event.Response
+	}
+	ident, ok := responseMap()[reflect.TypeOf(response)]
+	if !ok {
+		return fmt.Errorf("unrecognised response type (%s)", reflect.TypeOf(response).Name())
+	}
+	data, err := json.Marshal(response)
+	if err != nil {
+		utils.LogDebug("Send:: Marshal error for %s - %v", s.ConnID.String(), err)
+		return err
+	}
+
+	message := "event: " + ident + "\n"
+	if seq > 0 {
+		message += "id: " + strconv.Itoa(seq) + "\n"
+	}
+	message += "data: " + string(data) + "\n\n"
+	return s.queue.push([]byte(message))
+}
+
+// Close ends the stream once the queued messages are sent
+func (s *sseSink) Close() error {
+	s.queue.close()
+	return nil
+}
+
+// ObserverHandler streams the public events and state of the game to read-only
+// observers, e.g. for a TV showing the table
+func ObserverHandler(game IMessageSource, limiter *Limiter) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !originAllowed(r) {
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+		if wait := limiter.checkStream(r, time.Now()); wait > 0 {
+			w.Header().Set("Retry-After", retryAfter(wait))
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+
+		connID := uuid.New()
+		utils.LogDebug("ObserverHandler:: %s is assigned connID %s", r.RemoteAddr, connID.String())
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		sink := &sseSink{ConnID: connID, done: make(chan struct{})}
+		// newer servers let a handler set the write deadline, so a stalled
+		// observer is dropped like a stalled websocket
+		deadline, _ := w.(interface{ SetWriteDeadline(time.Time) error })
+		write := func(message []byte) error {
+			if deadline != nil {
+				_ = deadline.SetWriteDeadline(time.Now().Add(writeWait))
+			}
+			if _, err := w.Write(message); err != nil {
+				return err
+			}
+			flusher.Flush()
+			return nil
+		}
+		sink.queue = newOutboundQueue(connID, write, func() error {
+			close(sink.done)
+			return nil
+		})
+		// the writer must stop before the handler returns, as it uses w
+		defer sink.queue.wait()
+		defer func() { _ = sink.Close() }()
+		game.ConnectionStateChanged(connID, sink, connStateWatch)
+		defer game.ConnectionStateChanged(connID, sink, connStateDead)
+
+		keepAlive := time.NewTicker(sseKeepAlive)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case <-keepAlive.C:
+				if err := sink.queue.push([]byte(": keep-alive\n\n")); err != nil {
+					return
+				}
+			case <-sink.done:
+				return
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}
+}
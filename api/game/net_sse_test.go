@@ -0,0 +1,71 @@
+package game
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObserverStream(t *testing.T) {
+	g := NewGame(DefaultRules())
+	server := httptest.NewServer(http.HandlerFunc(ObserverHandler(g, NewLimiter(DefaultLimits()))))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	reader := bufio.NewReader(resp.Body)
+
+	// reads the lines of the next event
+	next := func() []string {
+		lines := []string{}
+		for {
+			line, err := reader.ReadString('\n')
+			assert.Nil(t, err)
+			line = strings.TrimSuffix(line, "\n")
+			if line == "" {
+				return lines
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	assert.Equal(t, "event: GAME_STATE_REFRESH", next()[0])
+	joinTestPlayer(g, "Al")
+	event := next()
+	assert.Equal(t, "event: PLAYER_JOINED", event[0])
+	assert.Regexp(t, `^id: \d+$`, event[1])
+	assert.Contains(t, event[2], `"name":"Al"`)
+
+	// the public state has no hand, and observers do not hold up the game
+	event = next()
+	assert.Equal(t, "event: GAME_STATE_REFRESH", event[0])
+	assert.Contains(t, event[1], `"selfHand":null`)
+	assert.Contains(t, event[1], `"opponents":[{"name":"Al"`)
+	withLock(g, func() {
+		assert.Equal(t, 0, g.unmappedCount())
+	})
+}
+
+func TestObserverLeavesEmptyTable(t *testing.T) {
+	g := NewGame(DefaultRules())
+	connID := uuid.New()
+	g.ConnectionStateChanged(connID, &testSink{}, connStateWatch)
+
+	// the game is only reset when players leave
+	var token int
+	withLock(g, func() {
+		token = g.turnToken
+	})
+	g.ConnectionStateChanged(connID, nil, connStateDead)
+	withLock(g, func() {
+		assert.Equal(t, token, g.turnToken)
+		assert.Empty(t, g.connections)
+	})
+}
@@ -0,0 +1,109 @@
+package game
+
+import "sort"
+
+const (
+	maxPartitions = 5
+	groupPenalty  = 10 // every extra combination is another trick to win
+	twoBonus      = 15
+	chopBonus     = 30
+)
+
+// a way of splitting a hand into playable combinations
+type handPartition struct {
+	Groups [][]card `json:"groups"`
+	Score  int      `json:"score"` // higher is stronger
+}
+
+// returns how strong a single combination is, based on its top card and on
+// whether it holds 2's or can chop
+func groupStrength(play []card) int {
+	strength := lowestGlobalRank + 1 - topRank(play)
+	for _, c := range play {
+		if c.FaceValue == 2 {
+			strength += twoBonus
+			break
+		}
+	}
+	if len(play) == 4 || len(play) >= 6 {
+		if p := determinePattern(play); p == patternQuad || p == patternSeqDoubles {
+			strength += chopBonus
+		}
+	}
+	return strength
+}
+
+// returns true if partition A should be ranked before partition B
+func betterPartition(a, b handPartition) bool {
+	if len(a.Groups) != len(b.Groups) {
+		return len(a.Groups) < len(b.Groups)
+	}
+	return a.Score > b.Score
+}
+
+// returns up to max ways of splitting the hand into the fewest combinations
+// (sequences, pairs, triples and bombs), strongest first
+func partitionHand(hand []card, max int) []handPartition {
+	memo := map[uint64][]handPartition{}
+
+	var best func(cards []card) []handPartition
+	best = func(cards []card) []handPartition {
+		if len(cards) == 0 {
+			return []handPartition{{Groups: [][]card{}}}
+		}
+		key := uint64(0)
+		lowest := cards[0]
+		for _, c := range cards {
+			key |= 1 << uint(c.GlobalRank)
+			if c.GlobalRank > lowest.GlobalRank {
+				lowest = c
+			}
+		}
+		if partitions, ok := memo[key]; ok {
+			return partitions
+		}
+
+		// every card belongs to some combination, so we only need to try the
+		// combinations that contain the lowest card
+		candidates := []handPartition{}
+		for _, play := range allPlays(cards) {
+			if cardInSet(lowest.GlobalRank, play.Cards) == -1 {
+				continue
+			}
+			rest := []card{}
+			for _, c := range cards {
+				if cardInSet(c.GlobalRank, play.Cards) == -1 {
+					rest = append(rest, c)
+				}
+			}
+			for _, sub := range best(rest) {
+				candidates = append(candidates, handPartition{
+					Groups: append([][]card{play.Cards}, sub.Groups...),
+					Score:  sub.Score + groupStrength(play.Cards) - groupPenalty,
+				})
+			}
+		}
+
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return betterPartition(candidates[i], candidates[j])
+		})
+		if len(candidates) > max {
+			candidates = candidates[:max]
+		}
+		memo[key] = candidates
+		return candidates
+	}
+
+	partitions := []handPartition{}
+	for _, partition := range best(hand) {
+		groups := make([][]card, 0, len(partition.Groups))
+		for _, group := range partition.Groups {
+			groups = append(groups, globalRankSort(group))
+		}
+		sort.SliceStable(groups, func(i, j int) bool {
+			return topRank(groups[i]) > topRank(groups[j])
+		})
+		partitions = append(partitions, handPartition{Groups: groups, Score: partition.Score})
+	}
+	return partitions
+}
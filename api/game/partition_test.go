@@ -0,0 +1,47 @@
+package game
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPartitionHand(t *testing.T) {
+	hand := []card{
+		{Suit: suitSpades, FaceValue: 3, SuitRank: 13, GlobalRank: 52},
+		{Suit: suitClubs, FaceValue: 4, SuitRank: 12, GlobalRank: 47},
+		{Suit: suitHearts, FaceValue: 5, SuitRank: 11, GlobalRank: 41},
+		{Suit: suitSpades, FaceValue: 9, SuitRank: 7, GlobalRank: 28},
+		{Suit: suitHearts, FaceValue: 9, SuitRank: 7, GlobalRank: 25},
+		{Suit: suitDiamonds, FaceValue: 13, SuitRank: 3, GlobalRank: 10},
+	}
+	partitions := partitionHand(hand, maxPartitions)
+
+	assert.NotEmpty(t, partitions)
+	assert.Equal(t, [][]card{hand[0:3], hand[3:5], hand[5:6]}, partitions[0].Groups)
+	for i := 1; i < len(partitions); i++ {
+		assert.False(t, betterPartition(partitions[i], partitions[i-1]))
+	}
+	for _, partition := range partitions {
+		count := 0
+		for _, group := range partition.Groups {
+			assert.NotEqual(t, patternInvalid, determinePattern(group))
+			count += len(group)
+		}
+		assert.Equal(t, len(hand), count)
+	}
+}
+
+func TestPartitionFullHand(t *testing.T) {
+	deck := buildDeck()
+	// the lowest 13 cards, i.e. 3 to 5 of every suit plus the 6 of spades
+	hand := deck[:13]
+
+	start := time.Now()
+	partitions := partitionHand(hand, maxPartitions)
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+
+	// a sequence of triples (3-3-3 to 5-5-5) and a sequence of 3-4-5-6
+	assert.Equal(t, 2, len(partitions[0].Groups))
+}
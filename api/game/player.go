@@ -1,19 +1,38 @@
 package game
 
-import "strings"
+import (
+	"strings"
+	"time"
+)
 
 // represents a player in the game
 type player struct {
-	Name        string `json:"name"`
-	Position    int    `json:"position"` // 1,2,3,4
-	Hand        []card `json:"-"`
-	CardsLeft   int    `json:"cardsLeft"`
-	IsPassed    bool   `json:"isPassed"`
-	IsTurn      bool   `json:"isTurn"`
-	WonLastGame bool   `json:"wonLastGame"`
-	Connected   bool   `json:"connected"`
-	LastPlayed  bool   `json:"lastPlayed"`
-	Score       int    `json:"score"`
+	Name          string   `json:"name"`
+	Position      int      `json:"position"` // 1,2,3,4
+	Hand          []card   `json:"-"`
+	CardsLeft     int      `json:"cardsLeft"`
+	IsPassed      bool     `json:"isPassed"`
+	IsTurn        bool     `json:"isTurn"`
+	WonLastGame   bool     `json:"wonLastGame"`
+	Connected     bool     `json:"connected"`
+	LastPlayed    bool     `json:"lastPlayed"`
+	Score         int      `json:"score"`
+	HintsUsed     int      `json:"hintsUsed"`
+	IsBot         bool     `json:"isBot"`
+	BotLevel      botLevel `json:"botLevel,omitempty"`
+	BotControlled bool     `json:"botControlled"`      // a bot is playing for the disconnected player
+	TimeBank      int64    `json:"timeBank,omitempty"` // milliseconds left on the player's chess clock
+	Forfeited     bool     `json:"forfeited"`
+	IsReady       bool     `json:"isReady"`
+	PausesUsed    int      `json:"pausesUsed"`
+	HasLeft       bool     `json:"hasLeft"`             // the player gave up their seat mid-game, so cannot re-join it
+	LatencyMs     int64    `json:"latencyMs,omitempty"` // round-trip time to the player's connection, if measured
+	lastHint      time.Time
+}
+
+// PlayedByBot returns true if a bot makes this player's moves
+func (p player) PlayedByBot() bool {
+	return p.IsBot || p.BotControlled
 }
 
 // provides some helpers to help reduce clutter in game object
@@ -30,6 +49,17 @@ func (p players) GetByName(name string) *player {
 	return nil
 }
 
+// HumanCount returns the number of players who are not bots
+func (p players) HumanCount() int {
+	count := 0
+	for _, player := range p {
+		if !player.IsBot {
+			count++
+		}
+	}
+	return count
+}
+
 // DeleteDisconnected removes all disconnected players
 func (p players) DeleteDisconnected() players {
 	kept := players{}
@@ -52,6 +82,16 @@ func (p players) DeleteByName(name string) players {
 	return kept
 }
 
+// Contains returns true if the player is in the list
+func (p players) Contains(thePlayer *player) bool {
+	for _, player := range p {
+		if player == thePlayer {
+			return true
+		}
+	}
+	return false
+}
+
 // PassedAndPlacedCount returns the number of players who have passed or been placed
 func (p players) PassedAndPlacedCount() int {
 	count := 0
@@ -159,6 +199,8 @@ func (p players) ResetAllGameStatuses() {
 		player.IsTurn = false
 		player.LastPlayed = false
 		player.WonLastGame = false
+		player.Forfeited = false
+		player.TimeBank = 0
 	}
 }
 
@@ -0,0 +1,150 @@
+package game
+
+import (
+	"fmt"
+	"time"
+)
+
+// DisconnectAction is what happens to a disconnected player's seat mid-game
+type DisconnectAction int
+
+const (
+	DisconnectWait    DisconnectAction = 1 // the game stays paused until the player returns
+	DisconnectBot     DisconnectAction = 2 // a bot plays for the player after the grace period
+	DisconnectForfeit DisconnectAction = 3 // the player forfeits after the grace period
+	DisconnectAbandon DisconnectAction = 4 // the game is abandoned after the grace period
+)
+
+// TimeoutAction is what happens when a player runs out of time for their move
+type TimeoutAction int
+
+const (
+	TimeoutPass    TimeoutAction = 1 // the player passes, or plays their lowest card if they cannot pass
+	TimeoutBot     TimeoutAction = 2 // a bot takes over the seat until the player makes a request
+	TimeoutForfeit TimeoutAction = 3 // the player forfeits the game and is placed last
+)
+
+// Rules holds the table rules and house options a game is played with
+type Rules struct {
+	HintsEnabled bool          // players may ask the server for suggested plays
+	HintCooldown time.Duration // minimum time between hints for a single player
+	BotDelay     time.Duration // pause before a bot makes its move
+	BotThinkTime time.Duration // time a hard bot may spend searching for its move
+	BotPlayouts  int           // most playouts a hard bot may run when searching for its move
+
+	DisconnectAction DisconnectAction
+	DisconnectGrace  time.Duration // time a disconnected player has to return before DisconnectAction applies
+
+	TurnTimeLimit time.Duration // time a player has to make their move, no limit if zero
+	TimeBank      time.Duration // chess clock time each player has for the whole game, used instead of TurnTimeLimit if set
+	TimeIncrement time.Duration // time added to a player's bank after each of their moves
+	TimeoutAction TimeoutAction
+
+	StartCountdown time.Duration // time between everyone in the lobby being ready and the game starting
+
+	PauseLimit    int  // times each player may pause a game
+	PauseHostOnly bool // only the host (the player in the first seat) may pause, and without limit
+}
+
+// DefaultRules returns the rules a game uses when none are specified
+func DefaultRules() Rules {
+	return Rules{
+		HintsEnabled: true,
+		HintCooldown: 10 * time.Second,
+		BotDelay:     time.Second,
+		BotThinkTime: 500 * time.Millisecond,
+		BotPlayouts:  2000,
+
+		DisconnectAction: DisconnectWait,
+		DisconnectGrace:  time.Minute,
+
+		TimeoutAction: TimeoutPass,
+
+		StartCountdown: 5 * time.Second,
+
+		PauseLimit: 2,
+	}
+}
+
+// returns true if moves are played against a clock
+func (r Rules) timed() bool {
+	return r.TurnTimeLimit > 0 || r.TimeBank > 0
+}
+
+// returns the rules as told to clients
+func (r Rules) info() rulesInfo {
+	return rulesInfo{
+		HintsEnabled:      r.HintsEnabled,
+		HintCooldownMs:    r.HintCooldown.Milliseconds(),
+		DisconnectAction:  r.DisconnectAction.String(),
+		DisconnectGraceMs: r.DisconnectGrace.Milliseconds(),
+		TurnTimeLimitMs:   r.TurnTimeLimit.Milliseconds(),
+		TimeBankMs:        r.TimeBank.Milliseconds(),
+		TimeIncrementMs:   r.TimeIncrement.Milliseconds(),
+		TimeoutAction:     r.TimeoutAction.String(),
+		StartCountdownMs:  r.StartCountdown.Milliseconds(),
+		PauseLimit:        r.PauseLimit,
+		PauseHostOnly:     r.PauseHostOnly,
+	}
+}
+
+// ParseDisconnectAction converts a name ("wait", "bot", "forfeit" or "abandon")
+// to a DisconnectAction
+func ParseDisconnectAction(name string) (DisconnectAction, error) {
+	switch name {
+	case "wait":
+		return DisconnectWait, nil
+	case "bot":
+		return DisconnectBot, nil
+	case "forfeit":
+		return DisconnectForfeit, nil
+	case "abandon":
+		return DisconnectAbandon, nil
+	default:
+		return 0, fmt.Errorf("unrecognised disconnect action (%s)", name)
+	}
+}
+
+// String returns the name of the action, as accepted by ParseDisconnectAction
+func (a DisconnectAction) String() string {
+	switch a {
+	case DisconnectWait:
+		return "wait"
+	case DisconnectBot:
+		return "bot"
+	case DisconnectForfeit:
+		return "forfeit"
+	case DisconnectAbandon:
+		return "abandon"
+	default:
+		return fmt.Sprintf("unknown (%d)", int(a))
+	}
+}
+
+// ParseTimeoutAction converts a name ("pass", "bot" or "forfeit") to a TimeoutAction
+func ParseTimeoutAction(name string) (TimeoutAction, error) {
+	switch name {
+	case "pass":
+		return TimeoutPass, nil
+	case "bot":
+		return TimeoutBot, nil
+	case "forfeit":
+		return TimeoutForfeit, nil
+	default:
+		return 0, fmt.Errorf("unrecognised timeout action (%s)", name)
+	}
+}
+
+// String returns the name of the action, as accepted by ParseTimeoutAction
+func (a TimeoutAction) String() string {
+	switch a {
+	case TimeoutPass:
+		return "pass"
+	case TimeoutBot:
+		return "bot"
+	case TimeoutForfeit:
+		return "forfeit"
+	default:
+		return fmt.Sprintf("unknown (%d)", int(a))
+	}
+}
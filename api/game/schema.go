@@ -0,0 +1,352 @@
+package game
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// where the generated files are checked in, relative to the repository root
+const (
+	GeneratedTypeScriptPath = "ui/src/lib/generated/messages.ts"
+	GeneratedSchemaPath     = "ui/src/lib/generated/messages.schema.json"
+)
+
+const generatedHeader = "Code generated by \"go run . generate\" in api; DO NOT EDIT."
+
+var rawMessageType = reflect.TypeOf(json.RawMessage{})
+
+// a value of an enumerated type, as named in generated code
+type enumMember struct {
+	Name  string
+	Value int
+}
+
+// lists the values of the enumerated types found in messages, which are
+// generated as enums rather than plain numbers
+func enumTypes() map[reflect.Type][]enumMember {
+	errorKinds := []enumMember{}
+	for kind, text := range errorTexts {
+		errorKinds = append(errorKinds, enumMember{pascalCase(text.Code), int(kind)})
+	}
+	sort.Slice(errorKinds, func(i, j int) bool { return errorKinds[i].Value < errorKinds[j].Value })
+
+	return map[reflect.Type][]enumMember{
+		reflect.TypeOf(errKindLobbyNotReady): errorKinds,
+		reflect.TypeOf(botLevelEasy): {
+			{"Easy", int(botLevelEasy)},
+			{"Medium", int(botLevelMedium)},
+			{"Hard", int(botLevelHard)},
+		},
+		reflect.TypeOf(gameStateInLobby): {
+			{"InLobby", int(gameStateInLobby)},
+			{"Running", int(gameStateRunning)},
+			{"Paused", int(gameStatePaused)},
+		},
+		reflect.TypeOf(patternSingle): {
+			{"Single", int(patternSingle)},
+			{"Double", int(patternDouble)},
+			{"Triple", int(patternTriple)},
+			{"Quad", int(patternQuad)},
+			{"SeqSingles", int(patternSeqSingles)},
+			{"SeqDoubles", int(patternSeqDoubles)},
+			{"SeqTriples", int(patternSeqTriples)},
+			{"SeqQuads", int(patternSeqQuads)},
+			{"Invalid", int(patternInvalid)},
+		},
+		reflect.TypeOf(suitSpades): {
+			{"Spades", int(suitSpades)},
+			{"Clubs", int(suitClubs)},
+			{"Diamonds", int(suitDiamonds)},
+			{"Hearts", int(suitHearts)},
+		},
+	}
+}
+
+// a field of a message type as it appears in JSON
+type jsonField struct {
+	Name     string
+	Type     reflect.Type
+	Optional bool // left out when empty
+}
+
+// lists the fields of a struct type as they are marshalled to JSON
+func jsonFields(t reflect.Type) []jsonField {
+	fields := []jsonField{}
+	for _, i := range encodedFields(t) {
+		field := t.Field(i)
+		name, options := field.Name, ""
+		if tag := field.Tag.Get("json"); tag != "" {
+			name = strings.Split(tag, ",")[0]
+			options = strings.TrimPrefix(tag, name)
+		}
+		fields = append(fields, jsonField{
+			Name:     name,
+			Type:     field.Type,
+			Optional: strings.Contains(options, ",omitempty"),
+		})
+	}
+
+	// errors gain these when marshalled
+	if t == reflect.TypeOf(errorResponse{}) {
+		fields = append(fields,
+			jsonField{Name: "code", Type: reflect.TypeOf("")},
+			jsonField{Name: "message", Type: reflect.TypeOf("")},
+		)
+	}
+	return fields
+}
+
+// the envelopes and every message kind, in that order
+func generatedRoots() []reflect.Type {
+	roots := []reflect.Type{reflect.TypeOf(Message{}), reflect.TypeOf(MessageV2{})}
+	for _, kind := range append(requestKinds(), responseKinds()...) {
+		roots = append(roots, kind.Type)
+	}
+	return roots
+}
+
+// finds the named types (structs and enums) reachable from the roots, by their
+// generated name
+func namedTypes(roots []reflect.Type) map[string]reflect.Type {
+	enums := enumTypes()
+	named := map[string]reflect.Type{}
+	var visit func(t reflect.Type)
+	visit = func(t reflect.Type) {
+		switch {
+		case t == timeType || t == rawMessageType:
+		case enums[t] != nil:
+			named[generatedName(t)] = t
+		case t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Map:
+			visit(t.Elem())
+		case t.Kind() == reflect.Struct:
+			if _, ok := named[generatedName(t)]; ok {
+				return
+			}
+			named[generatedName(t)] = t
+			for _, field := range jsonFields(t) {
+				visit(field.Type)
+			}
+		}
+	}
+	for _, t := range roots {
+		visit(t)
+	}
+	return named
+}
+
+// returns the names of the types in order
+func sortedNames(types map[string]reflect.Type) []string {
+	names := []string{}
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// names a Golang type in generated code, e.g. turnPlayRequest -> TurnPlayRequest
+func generatedName(t reflect.Type) string {
+	return strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+}
+
+// converts a code such as "LOBBY_NOT_READY" to "LobbyNotReady"
+func pascalCase(code string) string {
+	name := ""
+	for _, word := range strings.Split(strings.ToLower(code), "_") {
+		if word != "" {
+			name += strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return name
+}
+
+// GenerateTypeScript returns TypeScript types for every message kind and the
+// types they are built from
+func GenerateTypeScript() []byte {
+	enums := enumTypes()
+	types := namedTypes(generatedRoots())
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "// %s\n/* eslint-disable */\n", generatedHeader)
+	for _, name := range sortedNames(types) {
+		t := types[name]
+		b.WriteString("\n")
+		if members := enums[t]; members != nil {
+			fmt.Fprintf(&b, "export enum %s {\n", name)
+			for _, member := range members {
+				fmt.Fprintf(&b, "  %s = %d,\n", member.Name, member.Value)
+			}
+			b.WriteString("}\n")
+			continue
+		}
+
+		fields := jsonFields(t)
+		if len(fields) == 0 {
+			fmt.Fprintf(&b, "export interface %s {}\n", name)
+			continue
+		}
+		fmt.Fprintf(&b, "export interface %s {\n", name)
+		for _, field := range fields {
+			optional := ""
+			if field.Optional {
+				optional = "?"
+			}
+			fmt.Fprintf(&b, "  %s%s: %s;\n", field.Name, optional, typeScriptType(field.Type, field.Optional))
+		}
+		b.WriteString("}\n")
+	}
+
+	for _, list := range []struct {
+		name  string
+		kinds []messageKind
+	}{{"Requests", requestKinds()}, {"Responses", responseKinds()}} {
+		fmt.Fprintf(&b, "\nexport interface %s {\n", list.name)
+		for _, kind := range list.kinds {
+			fmt.Fprintf(&b, "  %s: %s;\n", kind.Ident, generatedName(kind.Type))
+		}
+		b.WriteString("}\n")
+	}
+	return []byte(b.String())
+}
+
+// returns the TypeScript type of a field, where optional is true if nil values
+// are left out rather than marshalled as null
+func typeScriptType(t reflect.Type, optional bool) string {
+	switch {
+	case t == timeType:
+		return "string"
+	case t == rawMessageType:
+		return "unknown"
+	case enumTypes()[t] != nil:
+		return generatedName(t)
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Ptr:
+		if optional {
+			return typeScriptType(t.Elem(), false)
+		}
+		return typeScriptType(t.Elem(), false) + " | null"
+	case reflect.Slice:
+		elem := typeScriptType(t.Elem(), false)
+		if strings.Contains(elem, " ") {
+			elem = "(" + elem + ")"
+		}
+		return elem + "[]"
+	case reflect.Map:
+		return fmt.Sprintf("{ [key: string]: %s }", typeScriptType(t.Elem(), false))
+	case reflect.Struct:
+		return generatedName(t)
+	}
+	return "unknown"
+}
+
+// GenerateJSONSchema returns a JSON Schema for "json.v2" messages, with the data
+// of every message kind and the types they are built from as definitions
+func GenerateJSONSchema() ([]byte, error) {
+	enums := enumTypes()
+	types := namedTypes(generatedRoots())
+
+	definitions := map[string]interface{}{}
+	for name, t := range types {
+		if members := enums[t]; members != nil {
+			values := []int{}
+			for _, member := range members {
+				values = append(values, member.Value)
+			}
+			definitions[name] = map[string]interface{}{"type": "integer", "enum": values}
+			continue
+		}
+
+		properties := map[string]interface{}{}
+		required := []string{}
+		for _, field := range jsonFields(t) {
+			properties[field.Name] = jsonSchemaType(field.Type, field.Optional)
+			if !field.Optional {
+				required = append(required, field.Name)
+			}
+		}
+		definitions[name] = map[string]interface{}{
+			"type":       "object",
+			"properties": properties,
+			"required":   required,
+		}
+	}
+
+	// a message of each kind, i.e. its envelope with the right data
+	for _, list := range []struct {
+		name  string
+		kinds []messageKind
+	}{{"Request", requestKinds()}, {"Response", responseKinds()}} {
+		messages := []interface{}{}
+		for _, kind := range list.kinds {
+			messages = append(messages, map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"kind": map[string]interface{}{"const": kind.Ident},
+					"id":   map[string]interface{}{"type": "string"},
+					"seq":  map[string]interface{}{"type": "integer"},
+					"data": jsonSchemaRef(generatedName(kind.Type)),
+				},
+				"required": []string{"kind"},
+			})
+		}
+		definitions[list.name] = map[string]interface{}{"oneOf": messages}
+	}
+
+	schema, err := json.MarshalIndent(map[string]interface{}{
+		"$schema":     "http://json-schema.org/draft-07/schema#",
+		"$comment":    generatedHeader,
+		"title":       "Tiến lên messages (json.v2)",
+		"oneOf":       []interface{}{jsonSchemaRef("Request"), jsonSchemaRef("Response")},
+		"definitions": definitions,
+	}, "", "  ")
+	return append(schema, '\n'), err
+}
+
+// returns the JSON Schema of a field, where optional is true if nil values are
+// left out rather than marshalled as null
+func jsonSchemaType(t reflect.Type, optional bool) interface{} {
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == rawMessageType:
+		return map[string]interface{}{}
+	case enumTypes()[t] != nil:
+		return jsonSchemaRef(generatedName(t))
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Ptr:
+		if optional {
+			return jsonSchemaType(t.Elem(), false)
+		}
+		return map[string]interface{}{"oneOf": []interface{}{jsonSchemaType(t.Elem(), false), map[string]interface{}{"type": "null"}}}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": jsonSchemaType(t.Elem(), false)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": jsonSchemaType(t.Elem(), false)}
+	case reflect.Struct:
+		return jsonSchemaRef(generatedName(t))
+	}
+	return map[string]interface{}{}
+}
+
+func jsonSchemaRef(name string) interface{} {
+	return map[string]interface{}{"$ref": "#/definitions/" + name}
+}
@@ -0,0 +1,53 @@
+package game
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// the generated files are checked in, so must be regenerated whenever the
+// message types change
+func TestGeneratedFilesAreCurrent(t *testing.T) {
+	schema, err := GenerateJSONSchema()
+	assert.Nil(t, err)
+
+	for path, expected := range map[string][]byte{
+		GeneratedTypeScriptPath: GenerateTypeScript(),
+		GeneratedSchemaPath:     schema,
+	} {
+		actual, err := ioutil.ReadFile(filepath.Join("..", "..", path))
+		assert.Nil(t, err)
+		assert.Equal(t, string(expected), string(actual), "%s is stale, run \"go run . generate\" in api", path)
+	}
+}
+
+func TestJSONSchemaDefinitions(t *testing.T) {
+	schema, err := GenerateJSONSchema()
+	assert.Nil(t, err)
+	parsed := struct {
+		Definitions map[string]struct {
+			Properties map[string]interface{} `json:"properties"`
+			Required   []string               `json:"required"`
+			Enum       []int                  `json:"enum"`
+			OneOf      []interface{}          `json:"oneOf"`
+		} `json:"definitions"`
+	}{}
+	assert.Nil(t, json.Unmarshal(schema, &parsed))
+
+	// every kind of message has a definition for its data
+	assert.Len(t, parsed.Definitions["Request"].OneOf, len(requestKinds()))
+	assert.Len(t, parsed.Definitions["Response"].OneOf, len(responseKinds()))
+	for _, kind := range append(requestKinds(), responseKinds()...) {
+		assert.Contains(t, parsed.Definitions, generatedName(kind.Type), kind.Ident)
+	}
+
+	// optional fields are not required, and the error code and message are
+	assert.Equal(t, []string{"playerName"}, parsed.Definitions["JoinGameRequest"].Required)
+	assert.Equal(t, []string{"kind", "code", "message"}, parsed.Definitions["ErrorResponse"].Required)
+	assert.Equal(t, []int{1, 2, 3, 4}, parsed.Definitions["Suit"].Enum)
+	assert.NotContains(t, parsed.Definitions["Player"].Properties, "hand")
+}
@@ -0,0 +1,158 @@
+package game
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"runtime"
+	"sync"
+)
+
+const lowestGlobalRank = 52 // the 3 of spades
+
+// SimulationOptions configures a batch of games played between bots
+type SimulationOptions struct {
+	Games int
+	Seed  int64
+	Bots  []string // level ("easy", "medium" or "hard") of the bot at each position
+	Rules Rules
+}
+
+// SimulationStats summarises the outcome of a batch of simulated games
+type SimulationStats struct {
+	Bots              []string
+	Games             int
+	Unfinished        int   // games abandoned for running too long
+	WinsBySeat        []int // ... indexed by position - 1
+	Moves             int
+	Rounds            int
+	Chops             int
+	LowestCardDealt   int // games where the 3 of spades was dealt
+	LowestCardHolders int // ... and won by the player holding it
+}
+
+// Simulate plays games between bots entirely in-process, without any connections.
+// Hard bots are limited by playouts rather than time, so the same options (and
+// seed) always produce the same stats.
+func Simulate(opts SimulationOptions) (SimulationStats, error) {
+	if len(opts.Bots) < 2 || len(opts.Bots) > 4 {
+		return SimulationStats{}, fmt.Errorf("need between 2 and 4 bots, not %d", len(opts.Bots))
+	}
+	levels := make([]botLevel, 0, len(opts.Bots))
+	for _, name := range opts.Bots {
+		level, err := parseBotLevel(name)
+		if err != nil {
+			return SimulationStats{}, err
+		}
+		levels = append(levels, level)
+	}
+
+	rules := opts.Rules
+	rules.BotThinkTime = 0
+	rules.TurnTimeLimit = 0
+	rules.TimeBank = 0
+	r := rand.New(rand.NewSource(opts.Seed))
+	seeds := make([]int64, opts.Games)
+	for i := range seeds {
+		seeds[i] = r.Int63()
+	}
+
+	// games are independent, so are spread across CPUs and the results are
+	// tallied in order afterwards
+	results := make([]*Game, opts.Games)
+	lowestHolders := make([]*player, opts.Games)
+	next := make(chan int)
+	wg := sync.WaitGroup{}
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i], lowestHolders[i] = simulateGame(rules, levels, seeds[i])
+			}
+		}()
+	}
+	for i := range seeds {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	stats := SimulationStats{
+		Bots:       opts.Bots,
+		WinsBySeat: make([]int, len(levels)),
+	}
+	for i, g := range results {
+		stats.Games++
+		if g.state != gameStateInLobby {
+			stats.Unfinished++
+			continue
+		}
+		winner := g.winPlaces[0]
+		stats.WinsBySeat[winner.Position-1]++
+		stats.Moves += g.stats.Moves
+		stats.Rounds += g.stats.Rounds
+		stats.Chops += g.stats.Chops
+		if lowestHolders[i] != nil {
+			stats.LowestCardDealt++
+			if lowestHolders[i] == winner {
+				stats.LowestCardHolders++
+			}
+		}
+	}
+
+	return stats, nil
+}
+
+// plays a single game between bots, returning the finished game and the player
+// (if any) who was dealt the 3 of spades
+func simulateGame(rules Rules, levels []botLevel, seed int64) (*Game, *player) {
+	g := &Game{rules: rules, rng: rand.New(rand.NewSource(seed)), inlineBots: true}
+	g.Init()
+	for pos, level := range levels {
+		g.players = append(g.players, &player{
+			Name:      fmt.Sprintf("Bot %d", pos+1),
+			Position:  pos + 1,
+			Connected: true,
+			IsBot:     true,
+			BotLevel:  level,
+		})
+	}
+
+	g.startGame(g.players[0])
+	var lowestHolder *player
+	for _, p := range g.players {
+		if cardInSet(lowestGlobalRank, p.Hand) >= 0 {
+			lowestHolder = p
+		}
+	}
+	g.scheduleBotTurn()
+	return g, lowestHolder
+}
+
+// Report writes a human-readable summary of the stats
+func (s SimulationStats) Report(w io.Writer) {
+	finished := s.Games - s.Unfinished
+	percent := func(n, of int) float64 {
+		if of == 0 {
+			return 0
+		}
+		return 100 * float64(n) / float64(of)
+	}
+	average := func(n int) float64 {
+		if finished == 0 {
+			return 0
+		}
+		return float64(n) / float64(finished)
+	}
+
+	fmt.Fprintf(w, "Games played:         %d (%d unfinished)\n", s.Games, s.Unfinished)
+	fmt.Fprintf(w, "Moves per game:       %.1f\n", average(s.Moves))
+	fmt.Fprintf(w, "Rounds per game:      %.1f\n", average(s.Rounds))
+	fmt.Fprintf(w, "Chops per game:       %.2f\n", average(s.Chops))
+	fmt.Fprintf(w, "3♠ holder wins:       %.1f%% (of %d games where it was dealt)\n", percent(s.LowestCardHolders, s.LowestCardDealt), s.LowestCardDealt)
+	fmt.Fprintf(w, "\nSeat  Bot     Wins    Win rate\n")
+	for i, wins := range s.WinsBySeat {
+		fmt.Fprintf(w, "%-4d  %-6s  %-6d  %.1f%%\n", i+1, s.Bots[i], wins, percent(wins, finished))
+	}
+}
@@ -0,0 +1,38 @@
+package game
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ishkanan/tienlen/api/utils"
+)
+
+func TestSimulateIsReproducible(t *testing.T) {
+	utils.SetLogOutput(ioutil.Discard)
+	defer utils.SetLogOutput(os.Stdout)
+
+	opts := SimulationOptions{
+		Games: 20,
+		Seed:  7,
+		Bots:  []string{"easy", "medium", "medium"},
+		Rules: DefaultRules(),
+	}
+	first, err := Simulate(opts)
+	assert.Nil(t, err)
+	second, err := Simulate(opts)
+	assert.Nil(t, err)
+
+	assert.Equal(t, first, second)
+	assert.Equal(t, 0, first.Unfinished)
+	assert.Equal(t, 20, first.WinsBySeat[0]+first.WinsBySeat[1]+first.WinsBySeat[2])
+}
+
+func TestSimulateRejectsBadBots(t *testing.T) {
+	_, err := Simulate(SimulationOptions{Games: 1, Bots: []string{"easy"}})
+	assert.NotNil(t, err)
+	_, err = Simulate(SimulationOptions{Games: 1, Bots: []string{"easy", "genius"}})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,60 @@
+package game
+
+import "time"
+
+// where the game gets the time from, which tests replace to control it
+type timeSource interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, fn func()) stoppable
+}
+
+// a pending callback from a timeSource
+type stoppable interface {
+	Stop() bool
+}
+
+// the real time
+type realTime struct{}
+
+func (realTime) Now() time.Time {
+	return time.Now()
+}
+
+func (realTime) AfterFunc(d time.Duration, fn func()) stoppable {
+	return time.AfterFunc(d, fn)
+}
+
+// a cancellable timer whose callback runs while holding the game lock
+type gameTimer struct {
+	timer     stoppable
+	deadline  time.Time
+	cancelled bool
+}
+
+// runs fn while holding the game lock once d has elapsed, unless the timer is
+// cancelled first
+func (g *Game) schedule(d time.Duration, fn func()) *gameTimer {
+	t := &gameTimer{deadline: g.timeSource.Now().Add(d)}
+	t.timer = g.timeSource.AfterFunc(d, func() {
+		g.mutex.Lock()
+		defer g.mutex.Unlock()
+		defer g.scheduleBotTurn()
+
+		// the timer may have been cancelled while we waited for the lock
+		if t.cancelled {
+			return
+		}
+		t.cancelled = true
+		fn()
+	})
+	return t
+}
+
+// Cancel stops the timer from firing - must be called while holding the game lock
+func (t *gameTimer) Cancel() {
+	if t == nil {
+		return
+	}
+	t.cancelled = true
+	t.timer.Stop()
+}
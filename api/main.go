@@ -1,30 +1,177 @@
 package main
 
 import (
+	"crypto/tls"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/ishkanan/tienlen/api/game"
 	"github.com/ishkanan/tienlen/api/utils"
 )
 
 var addr = flag.String("addr", "localhost:27000", "HTTP service address")
+var tlsCert = flag.String("tls-cert", "", "Certificate file to serve HTTPS with, which is reloaded when it changes")
+var tlsKey = flag.String("tls-key", "", "Private key file for -tls-cert")
+var origins = flag.String("allowed-origins", "", "Comma-separated origins of other sites that may connect, e.g. https://*.example.com (any if empty)")
 var uiFolder = flag.String("ui", "dist", "Folder container UI files")
+var defaultRules = game.DefaultRules()
+var hints = flag.Bool("hints", defaultRules.HintsEnabled, "Allow players to request suggested plays")
+var hintCooldown = flag.Duration("hint-cooldown", defaultRules.HintCooldown, "Minimum time between hints for a player")
+var botDelay = flag.Duration("bot-delay", defaultRules.BotDelay, "Pause before a bot makes its move")
+var botThinkTime = flag.Duration("bot-think", defaultRules.BotThinkTime, "Time a hard bot may spend searching for its move")
+var onDisconnect = flag.String("on-disconnect", "wait", "What happens to a disconnected player's seat mid-game (wait, bot, forfeit, abandon)")
+var turnTimeLimit = flag.Duration("turn-time", 0, "Time a player has to make their move (0 for no limit)")
+var timeBank = flag.Duration("time-bank", 0, "Chess clock time each player has for the whole game, instead of -turn-time (0 for no clock)")
+var timeIncrement = flag.Duration("time-increment", 0, "Time added to a player's chess clock after each of their moves")
+var onTimeout = flag.String("on-timeout", "pass", "What happens when a player runs out of time (pass, bot, forfeit)")
+var startCountdown = flag.Duration("start-countdown", defaultRules.StartCountdown, "Time between everyone in the lobby being ready and the game starting")
+var pauseLimit = flag.Int("pause-limit", defaultRules.PauseLimit, "Times each player may pause a game")
+var pauseHostOnly = flag.Bool("pause-host-only", defaultRules.PauseHostOnly, "Only the host (first seat) may pause a game, and without limit")
+var defaultLimits = game.DefaultLimits()
+var messageRate = flag.Float64("rate-limit", defaultLimits.MessageRate, "Messages per second a connection may send")
+var messageBurst = flag.Int("rate-burst", defaultLimits.MessageBurst, "Messages a connection may send at once")
+var addressRate = flag.Float64("ip-rate-limit", defaultLimits.AddressRate, "Messages per second all connections from one IP address may send")
+var addressBurst = flag.Int("ip-rate-burst", defaultLimits.AddressBurst, "Messages all connections from one IP address may send at once")
+var maxMessageSize = flag.Int64("max-message-size", defaultLimits.MaxMessageSize, "Largest message a client may send, in bytes")
+var disconnectGrace = flag.Duration("disconnect-grace", defaultRules.DisconnectGrace, "Time a disconnected player has to return before -on-disconnect applies")
 
 func main() {
-	fmt.Println("Tiến lên (aka. Thirteen) server\n" +
-		"  A simple server implementation of the popular Vietnamese card game.\n",
+	if len(os.Args) > 1 && os.Args[1] == "simulate" {
+		simulate(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "generate" {
+		generate(os.Args[2:])
+		return
+	}
+
+	fmt.Print("Tiến lên (aka. Thirteen) server\n" +
+		"  A simple server implementation of the popular Vietnamese card game.\n\n",
 	)
 
 	flag.Parse()
 	log.SetFlags(0)
 
-	theGame := game.NewGame()
+	rules := defaultRules
+	rules.HintsEnabled = *hints
+	rules.HintCooldown = *hintCooldown
+	rules.BotDelay = *botDelay
+	rules.BotThinkTime = *botThinkTime
+	rules.DisconnectGrace = *disconnectGrace
+	rules.TurnTimeLimit = *turnTimeLimit
+	rules.TimeBank = *timeBank
+	rules.TimeIncrement = *timeIncrement
+	rules.StartCountdown = *startCountdown
+	rules.PauseLimit = *pauseLimit
+	rules.PauseHostOnly = *pauseHostOnly
+
+	var err error
+	rules.DisconnectAction, err = game.ParseDisconnectAction(*onDisconnect)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rules.TimeoutAction, err = game.ParseTimeoutAction(*onTimeout)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	limiter := game.NewLimiter(game.Limits{
+		MessageRate:    *messageRate,
+		MessageBurst:   *messageBurst,
+		AddressRate:    *addressRate,
+		AddressBurst:   *addressBurst,
+		MaxMessageSize: *maxMessageSize,
+	})
+
+	if *origins != "" {
+		game.SetAllowedOrigins(strings.Split(*origins, ","))
+	}
+
+	theGame := game.NewGame(rules)
 	http.Handle("/", http.FileServer(http.Dir(*uiFolder)))
-	http.HandleFunc("/api", game.ConnectionHandler(theGame))
+	http.HandleFunc("/api", game.ConnectionHandler(theGame, limiter))
+	http.HandleFunc("/api/poll", game.PollHandler(theGame, limiter))
+	http.HandleFunc("/api/limits", limiter.StatsHandler)
+	http.HandleFunc("/api/events", game.ObserverHandler(theGame, limiter))
+
+	if *tlsCert == "" && *tlsKey == "" {
+		utils.LogInfo("Server listening on %s ...", *addr)
+		log.Fatal(http.ListenAndServe(*addr, nil))
+	}
+	if *tlsCert == "" || *tlsKey == "" {
+		log.Fatal("both -tls-cert and -tls-key are needed to serve HTTPS")
+	}
+	certs, err := utils.NewCertReloader(*tlsCert, *tlsKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+	server := &http.Server{
+		Addr: *addr,
+		TLSConfig: &tls.Config{
+			GetCertificate: certs.GetCertificate,
+			MinVersion:     tls.VersionTLS12,
+		},
+	}
+	utils.LogInfo("Server listening on %s (HTTPS) ...", *addr)
+	log.Fatal(server.ListenAndServeTLS("", ""))
+}
+
+// runs games between bots without starting the server, and prints statistics
+func simulate(args []string) {
+	flags := flag.NewFlagSet("simulate", flag.ExitOnError)
+	games := flags.Int("games", 1000, "Number of games to play")
+	seed := flags.Int64("seed", 1, "Random seed, so runs can be reproduced")
+	bots := flags.String("bots", "easy,medium,hard,medium", "Comma-separated bot level (easy, medium, hard) for each seat")
+	playouts := flags.Int("playouts", 100, "Most playouts a hard bot may run per move")
+	_ = flags.Parse(args)
+
+	log.SetFlags(0)
+	utils.SetLogOutput(ioutil.Discard)
+
+	rules := game.DefaultRules()
+	rules.BotPlayouts = *playouts
+	stats, err := game.Simulate(game.SimulationOptions{
+		Games: *games,
+		Seed:  *seed,
+		Bots:  strings.Split(*bots, ","),
+		Rules: rules,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	stats.Report(os.Stdout)
+}
+
+// writes the TypeScript types and JSON Schema generated from the message types
+func generate(args []string) {
+	flags := flag.NewFlagSet("generate", flag.ExitOnError)
+	root := flags.String("root", "..", "Repository root the generated files are written under")
+	_ = flags.Parse(args)
+
+	log.SetFlags(0)
 
-	utils.LogInfo("Server listening on %s ...", *addr)
-	log.Fatal(http.ListenAndServe(*addr, nil))
+	schema, err := game.GenerateJSONSchema()
+	if err != nil {
+		log.Fatal(err)
+	}
+	files := map[string][]byte{
+		game.GeneratedTypeScriptPath: game.GenerateTypeScript(),
+		game.GeneratedSchemaPath:     schema,
+	}
+	for path, content := range files {
+		path = filepath.Join(*root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			log.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, content, 0644); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("Wrote", path)
+	}
 }
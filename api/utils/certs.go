@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+)
+
+// how often the certificate files are checked for changes, at most
+const certCheckInterval = 10 * time.Second
+
+// CertReloader serves a TLS certificate from files, loading it again when the
+// files change (e.g. when the certificate is renewed) without a restart
+type CertReloader struct {
+	certFile  string
+	keyFile   string
+	mutex     sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time // ... of the newest file when the certificate was loaded
+	lastCheck time.Time
+}
+
+// NewCertReloader loads the certificate and key from the files
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile}
+	modTime, err := r.newestModTime()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(modTime); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate returns the current certificate, for use in a tls.Config
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if now := time.Now(); now.Sub(r.lastCheck) >= certCheckInterval {
+		r.lastCheck = now
+		r.reloadIfChanged()
+	}
+	return r.cert, nil
+}
+
+// loads the certificate again if the files have changed, keeping the current
+// one if they cannot be loaded (e.g. only one has been replaced so far)
+func (r *CertReloader) reloadIfChanged() {
+	modTime, err := r.newestModTime()
+	if err != nil || !modTime.After(r.modTime) {
+		return
+	}
+	if err := r.load(modTime); err != nil {
+		LogInfo("CertReloader: Keeping the current certificate, could not load the new one - %v", err)
+		return
+	}
+	LogInfo("CertReloader: Loaded the new certificate from %s", r.certFile)
+}
+
+func (r *CertReloader) load(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.cert = &cert
+	r.modTime = modTime
+	return nil
+}
+
+func (r *CertReloader) newestModTime() (time.Time, error) {
+	newest := time.Time{}
+	for _, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+	}
+	return newest, nil
+}
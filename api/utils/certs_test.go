@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writes a self-signed certificate for the name, and its key
+func writeTestCert(t *testing.T, certFile, keyFile, name string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+	assert.Nil(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.Nil(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+}
+
+func TestCertReloader(t *testing.T) {
+	SetLogOutput(ioutil.Discard)
+	defer SetLogOutput(os.Stdout)
+	dir, err := ioutil.TempDir("", "certs")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+
+	_, err = NewCertReloader(certFile, keyFile)
+	assert.NotNil(t, err)
+
+	writeTestCert(t, certFile, keyFile, "old")
+	r, err := NewCertReloader(certFile, keyFile)
+	assert.Nil(t, err)
+	subject := func() string {
+		cert, err := r.GetCertificate(nil)
+		assert.Nil(t, err)
+		parsed, err := x509.ParseCertificate(cert.Certificate[0])
+		assert.Nil(t, err)
+		return parsed.Subject.CommonName
+	}
+	assert.Equal(t, "old", subject())
+
+	// a half-replaced pair is ignored until it is complete
+	later := time.Now().Add(time.Minute)
+	assert.Nil(t, ioutil.WriteFile(certFile, []byte("not a certificate"), 0600))
+	assert.Nil(t, os.Chtimes(certFile, later, later))
+	r.lastCheck = time.Time{}
+	assert.Equal(t, "old", subject())
+
+	writeTestCert(t, certFile, keyFile, "new")
+	later = later.Add(time.Minute)
+	assert.Nil(t, os.Chtimes(certFile, later, later))
+	r.lastCheck = time.Time{}
+	assert.Equal(t, "new", subject())
+}
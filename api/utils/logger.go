@@ -2,19 +2,28 @@ package utils
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"time"
 )
 
+var output io.Writer = os.Stdout
+
 func now() string {
 	return time.Now().Format("2-Jan 15:04:05")
 }
 
-// LogDebug prints a DEBUG message to stdout
+// SetLogOutput changes where log messages are written to (stdout by default)
+func SetLogOutput(w io.Writer) {
+	output = w
+}
+
+// LogDebug prints a DEBUG message to the log output
 func LogDebug(message string, params ...interface{}) {
-	fmt.Printf("[%s] DEBUG  %s\n", now(), fmt.Sprintf(message, params...))
+	fmt.Fprintf(output, "[%s] DEBUG  %s\n", now(), fmt.Sprintf(message, params...))
 }
 
-// LogInfo prints a INFO message to stdout
+// LogInfo prints a INFO message to the log output
 func LogInfo(message string, params ...interface{}) {
-	fmt.Printf("[%s] INFO   %s\n", now(), fmt.Sprintf(message, params...))
+	fmt.Fprintf(output, "[%s] INFO   %s\n", now(), fmt.Sprintf(message, params...))
 }
@@ -1,28 +1,6 @@
-export enum Suit {
-  Spades = 1,
-  Clubs = 2,
-  Diamonds = 3,
-  Hearts = 4,
-}
-
-export interface Card {
-  suit: Suit;
-  faceValue: number;
-  suitRank: number;
-  globalRank: number;
-}
-
-export interface Player {
-  name: string;
-  position: number;
-  cardsLeft: number;
-  isPassed: boolean;
-  isTurn: boolean;
-  wonLastGame: boolean;
-  connected: boolean;
-  lastPlayed: boolean;
-  score: number;
-}
+// The types shared with messages are generated from the server's
+export { Suit } from './generated/messages';
+export type { Card, HandPartition, Player } from './generated/messages';
 
 export enum EventSeverity {
   Info = 1,
@@ -2,6 +2,8 @@ import { game, ConnectionState } from '~/store/game';
 import { Card } from './models';
 import {
   Message,
+  MessageV2,
+  HelloRequest,
   JoinGameRequest,
   StartGameRequest,
   TurnPassRequest,
@@ -17,20 +19,30 @@ const wsUrl =
   window.location.pathname +
   (window.location.pathname.endsWith('/') ? 'api' : '/api');
 
+// the version of the messages this client understands
+const protocolVersion = 1;
+
 let socket: WebSocket | undefined = undefined;
+// the last event seen, so missed events are re-sent on re-joining
+let lastEventSeq: number | undefined = undefined;
 
 export function joinGame({ name }: { name: string }): void {
   if (socket) socket.close();
 
   game.connState = ConnectionState.Connecting;
 
-  socket = new WebSocket(wsUrl, 'json');
+  socket = new WebSocket(wsUrl, ['json.v2', 'json']);
   socket.onmessage = onMessage;
   socket.onclose = onClose;
   socket.onerror = onError;
   socket.onopen = () => {
     game.connState = ConnectionState.Connected;
-    const request: JoinGameRequest = { playerName: name };
+    const hello: HelloRequest = { protocolVersion, features: [] };
+    sendMessage({
+      kind: 'HELLO',
+      request: hello,
+    });
+    const request: JoinGameRequest = { playerName: name, lastEventSeq };
     sendMessage({
       kind: 'JOIN_GAME',
       request,
@@ -84,6 +96,7 @@ function sendMessage({
 }: {
   kind: string;
   request:
+    | HelloRequest
     | JoinGameRequest
     | StartGameRequest
     | TurnPassRequest
@@ -92,6 +105,11 @@ function sendMessage({
     | ChangeNameRequest;
 }) {
   if (!socket || game.connState !== ConnectionState.Connected) return;
+  if (socket.protocol === 'json.v2') {
+    const message: MessageV2 = { kind, data: request };
+    socket.send(JSON.stringify(message));
+    return;
+  }
   const message: Message = {
     kind,
     data: btoa(JSON.stringify(request)),
@@ -118,8 +136,16 @@ const actions: Record<string, any> = {
 };
 
 function onMessage(event: MessageEvent) {
+  if (socket && socket.protocol === 'json.v2') {
+    const message: MessageV2 | undefined = JSON.parse(event.data);
+    if (!message) return;
+    if (message.seq) lastEventSeq = message.seq;
+    actions[message.kind] && actions[message.kind]({ response: message.data });
+    return;
+  }
   const message: Message | undefined = JSON.parse(event.data);
   if (!message) return;
+  if (message.seq) lastEventSeq = message.seq;
   const parsed: unknown = JSON.parse(atob(message.data));
   actions[message.kind] && actions[message.kind]({ response: parsed });
 }
@@ -83,6 +83,30 @@ class Game extends VuexModule {
       message: 'The game is full.',
       toast: true,
     },
+    [ErrorKind.HintsDisabled]: {
+      message: 'Hints are disabled for this game.',
+      toast: false,
+    },
+    [ErrorKind.HintCooldown]: {
+      message: 'Please wait a little before asking for another hint.',
+      toast: false,
+    },
+    [ErrorKind.InvalidBot]: {
+      message: 'That bot cannot be added or removed.',
+      toast: false,
+    },
+    [ErrorKind.NoPausesLeft]: {
+      message: 'You have no pauses left for this game.',
+      toast: false,
+    },
+    [ErrorKind.IncompatibleClient]: {
+      message: 'This page is out of date, please refresh it.',
+      toast: true,
+    },
+    [ErrorKind.RateLimited]: {
+      message: 'Slow down! Please wait a moment before trying again.',
+      toast: true,
+    },
   };
 
   get isInLobby(): boolean {